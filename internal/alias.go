@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"robloxapid/internal/config"
+	"robloxapid/internal/fetcher"
+)
+
+const aliasCacheTTL = 24 * time.Hour
+
+const (
+	usernameLookupURL  = "https://users.roblox.com/v1/usernames/users"
+	groupNameLookupURL = "https://groups.roblox.com/v1/groups/search/lookup?groupName=%s"
+)
+
+type aliasLookup func(ctx context.Context, name string, req fetcher.Request) (id, canonicalName string, err error)
+
+// aliasLookups lists the endpoint types whose IDs may be given as "@name".
+var aliasLookups = map[string]aliasLookup{
+	"users":  lookupUsername,
+	"groups": lookupGroupName,
+}
+
+type resolvedAlias struct {
+	id         string
+	name       string
+	resolvedAt time.Time
+}
+
+var aliasCache = struct {
+	sync.Mutex
+	entries map[string]resolvedAlias
+}{entries: make(map[string]resolvedAlias)}
+
+type aliasLookupResponse struct {
+	Data []struct {
+		ID   json.Number `json:"id"`
+		Name string      `json:"name"`
+	} `json:"data"`
+}
+
+// AliasGate returns the targets allowed to publish id, the canonical ID the
+// "@name" endpoint aliasID resolved to.
+type AliasGate func(targets []Target, endpointType, aliasID, id string) []Target
+
+// processAlias refreshes the canonical data page behind an "@name" ID and
+// publishes a small alias page pointing at it, which Module:Roapid follows.
+func processAlias(ctx context.Context, targets []Target, cfg *config.Config, admit AliasGate, endpointType, id string) error {
+	canonicalID, canonicalName, err := resolveAlias(ctx, cfg, endpointType, strings.TrimPrefix(id, "@"))
+	if err != nil {
+		return err
+	}
+
+	if admit != nil {
+		if targets = admit(targets, endpointType, id, canonicalID); len(targets) == 0 {
+			return fmt.Errorf("%s %s resolves to %s, which no wiki may track", endpointType, id, canonicalID)
+		}
+	}
+
+	if err := ProcessEndpoint(ctx, targets, cfg, admit, endpointType, canonicalID); err != nil {
+		return err
+	}
+
+	aliasData, err := json.Marshal(map[string]string{
+		"roAliasOf": canonicalID,
+		"name":      canonicalName,
+	})
+	if err != nil {
+		return err
+	}
+
+	slug := fmt.Sprintf("%s-%s.json", endpointType, id)
+	source := fmt.Sprintf("%s lookup of %s", endpointType, id)
+	return publishToTargets(ctx, targets, slug, source, aliasData)
+}
+
+func resolveAlias(ctx context.Context, cfg *config.Config, endpointType, name string) (id, canonicalName string, err error) {
+	lookup, ok := aliasLookups[endpointType]
+	if !ok {
+		return "", "", fmt.Errorf("%s does not support @name identifiers", endpointType)
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("empty %s name", endpointType)
+	}
+
+	key := aliasCacheKey(endpointType, name)
+	aliasCache.Lock()
+	cached, ok := aliasCache.entries[key]
+	aliasCache.Unlock()
+	if ok && time.Since(cached.resolvedAt) < aliasCacheTTL {
+		return cached.id, cached.name, nil
+	}
+
+	id, canonicalName, err = lookup(ctx, name, robloxCookieRequest(cfg, endpointType, "@"+name))
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving %s name %q: %w", endpointType, name, err)
+	}
+
+	aliasCache.Lock()
+	aliasCache.entries[key] = resolvedAlias{id: id, name: canonicalName, resolvedAt: time.Now()}
+	aliasCache.Unlock()
+	return id, canonicalName, nil
+}
+
+// cachedAlias returns the ID an "@name" ID last resolved to, if it was resolved.
+func cachedAlias(endpointType, id string) (string, bool) {
+	name, ok := strings.CutPrefix(id, "@")
+	if !ok {
+		return "", false
+	}
+	aliasCache.Lock()
+	defer aliasCache.Unlock()
+	cached, ok := aliasCache.entries[aliasCacheKey(endpointType, name)]
+	return cached.id, ok
+}
+
+func aliasCacheKey(endpointType, name string) string {
+	return endpointType + "-" + strings.ToLower(name)
+}
+
+func lookupUsername(ctx context.Context, name string, req fetcher.Request) (string, string, error) {
+	body, err := json.Marshal(map[string]any{
+		"usernames":          []string{name},
+		"excludeBannedUsers": false,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req.Method = http.MethodPost
+	req.URL = usernameLookupURL
+	req.Body = body
+	respBody, err := fetcher.Do(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+	return firstAliasMatch(respBody, name)
+}
+
+func lookupGroupName(ctx context.Context, name string, req fetcher.Request) (string, string, error) {
+	req.URL = fmt.Sprintf(groupNameLookupURL, neturl.QueryEscape(name))
+	respBody, err := fetcher.Do(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+	return firstAliasMatch(respBody, name)
+}
+
+func firstAliasMatch(respBody []byte, name string) (string, string, error) {
+	var res aliasLookupResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return "", "", fmt.Errorf("failed to parse lookup response: %w", err)
+	}
+	for _, entry := range res.Data {
+		if strings.EqualFold(entry.Name, name) && entry.ID != "" {
+			return entry.ID.String(), entry.Name, nil
+		}
+	}
+	return "", "", fmt.Errorf("no exact match for %q", name)
+}
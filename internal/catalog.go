@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"robloxapid/internal/fetcher"
+)
+
+type catalogItemRequest struct {
+	ItemType string `json:"itemType"`
+	ID       int64  `json:"id"`
+}
+
+type catalogDetailsResponse struct {
+	Data []json.RawMessage `json:"data"`
+}
+
+// splitCatalogID accepts "<assetId>" or "bundle-<bundleId>".
+func splitCatalogID(id string) (itemType string, itemID int64, err error) {
+	itemType = "Asset"
+	raw := id
+	if rest, ok := strings.CutPrefix(strings.ToLower(id), "bundle-"); ok {
+		itemType, raw = "Bundle", rest
+	}
+	itemID, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil || itemID <= 0 {
+		return "", 0, fmt.Errorf("invalid catalog identifier %q, expected assetId or bundle-bundleId", id)
+	}
+	return itemType, itemID, nil
+}
+
+func fetchCatalogItem(ctx context.Context, req fetcher.Request, id string) ([]byte, error) {
+	itemType, itemID, err := splitCatalogID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string][]catalogItemRequest{
+		"items": {{ItemType: itemType, ID: itemID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Method = http.MethodPost
+	req.Body = body
+	respBody, err := fetcher.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res catalogDetailsResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog details: %w", err)
+	}
+	if len(res.Data) == 0 {
+		return nil, fmt.Errorf("catalog item %s not found", id)
+	}
+	return res.Data[0], nil
+}
@@ -3,7 +3,7 @@ package checker
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -12,28 +12,28 @@ func HasChanged(path string, newData []byte) (bool, error) {
 	dataRoot, err := os.OpenRoot("data")
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Printf("[DEBUG] checker.HasChanged: data directory does not exist -> treat as changed")
+			slog.Debug("data directory does not exist, treating as changed")
 			return true, nil
 		}
-		log.Printf("[ERROR] checker.HasChanged: failed to open data root: %v", err)
+		slog.Error("failed to open data root", "err", err)
 		return false, err
 	}
 	defer dataRoot.Close()
 
 	fullPath := filepath.Join("data", path)
-	log.Printf("[DEBUG] checker.HasChanged: checking %s", fullPath)
+	slog.Debug("checking for changes", "path", fullPath)
 	oldData, err := dataRoot.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Printf("[DEBUG] checker.HasChanged: file does not exist -> treat as changed: %s", fullPath)
+			slog.Debug("file does not exist, treating as changed", "path", fullPath)
 			return true, nil
 		}
-		log.Printf("[ERROR] checker.HasChanged: failed to read %s: %v", fullPath, err)
+		slog.Error("failed to read data file", "path", fullPath, "err", err)
 		return false, err
 	}
 
 	if bytes.Equal(oldData, newData) {
-		log.Printf("[DEBUG] checker.HasChanged: raw compare -> unchanged: %s", fullPath)
+		slog.Debug("raw compare unchanged", "path", fullPath)
 		return false, nil
 	}
 
@@ -41,10 +41,10 @@ func HasChanged(path string, newData []byte) (bool, error) {
 	if err := json.Unmarshal(oldData, &oldDataMap); err != nil {
 		eq := bytes.Equal(oldData, newData)
 		if eq {
-			log.Printf("[DEBUG] checker.HasChanged: raw compare -> unchanged: %s", fullPath)
+			slog.Debug("raw compare unchanged", "path", fullPath)
 			return false, nil
 		}
-		log.Printf("[DEBUG] checker.HasChanged: raw compare -> changed: %s", fullPath)
+		slog.Debug("raw compare changed", "path", fullPath)
 		return true, nil
 	}
 
@@ -52,17 +52,17 @@ func HasChanged(path string, newData []byte) (bool, error) {
 	if err := json.Unmarshal(newData, &newDataMap); err != nil {
 		eq := bytes.Equal(oldData, newData)
 		if eq {
-			log.Printf("[DEBUG] checker.HasChanged: new data unmarshal failed but raw compare -> unchanged: %s", fullPath)
+			slog.Debug("new data is not an object, raw compare unchanged", "path", fullPath)
 			return false, nil
 		}
-		log.Printf("[DEBUG] checker.HasChanged: new data unmarshal failed but raw compare -> changed: %s", fullPath)
+		slog.Debug("new data is not an object, raw compare changed", "path", fullPath)
 		return true, nil
 	}
 	changed := !equalIgnoringRo(oldDataMap, newDataMap)
 	if changed {
-		log.Printf("[DEBUG] checker.HasChanged: content changed: %s", fullPath)
+		slog.Debug("content changed", "path", fullPath)
 	} else {
-		log.Printf("[DEBUG] checker.HasChanged: content unchanged: %s", fullPath)
+		slog.Debug("content unchanged", "path", fullPath)
 	}
 	return changed, nil
 }
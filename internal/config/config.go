@@ -1,19 +1,48 @@
 package config
 
 import (
+	"cmp"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Discovery modes: endpoints are found through the queue categories the module
+// adds to pages, or through the data pages loaded by pages embedding it.
+const (
+	DiscoveryCategories = "categories"
+	DiscoveryEmbeddedIn = "embeddedin"
+)
+
+const (
+	defaultMaxPages              = 5
+	defaultVirtualEventsPastDays = 30
+	defaultFetchCacheTTL         = 30 * time.Second
+	defaultDrainTimeout          = 30 * time.Second
+	defaultStatusInterval        = 5 * time.Minute
+)
+
 type Config struct {
 	Server           ServerConfig           `json:"server"`
 	Wiki             WikiConfig             `json:"wiki"`
+	Wikis            []WikiConfig           `json:"wikis"`
 	DynamicEndpoints DynamicEndpointsConfig `json:"dynamicEndpoints"`
 	OpenCloud        OpenCloudConfig        `json:"openCloud"`
 	Roblox           RobloxConfig           `json:"roblox"`
 	LuaMessages      LuaMessagesConfig      `json:"luaMessages"`
+	Credentials      CredentialsConfig      `json:"credentials"`
+	Logging          LoggingConfig          `json:"logging"`
+}
+
+type LoggingConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+	Output string `json:"output"`
 }
 
 type LuaMessagesConfig struct {
@@ -22,23 +51,100 @@ type LuaMessagesConfig struct {
 }
 
 type ServerConfig struct {
-	ListenAddress         string `json:"listenAddress"`
-	CategoryCheckInterval string `json:"categoryCheckInterval"`
-	DataRefreshInterval   string `json:"dataRefreshInterval"`
+	ListenAddress         string        `json:"listenAddress"`
+	CategoryCheckInterval string        `json:"categoryCheckInterval"`
+	FullScanInterval      string        `json:"fullScanInterval"`
+	StatusInterval        string        `json:"statusInterval"`
+	StatusReportPage      string        `json:"statusReportPage"`
+	DataRefreshInterval   string        `json:"dataRefreshInterval"`
+	FetchCacheTTL         string        `json:"fetchCacheTTL"`
+	DrainTimeout          string        `json:"drainTimeout"`
+	Webhook               WebhookConfig `json:"webhook"`
+}
+
+type WebhookConfig struct {
+	Path   string `json:"path"`
+	Secret string `json:"secret"`
 }
 
 type WikiConfig struct {
-	APIURL    string `json:"apiUrl"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Namespace string `json:"namespace"`
-	Debug     bool   `json:"debug"`
+	Name           string            `json:"name"`
+	APIURL         string            `json:"apiUrl"`
+	Username       string            `json:"username"`
+	Password       string            `json:"password"`
+	Namespace      string            `json:"namespace"`
+	CategoryPrefix string            `json:"categoryPrefix"`
+	Discovery      string            `json:"discovery"`
+	LuaMessages    LuaMessagesConfig `json:"luaMessages"`
+	Debug          bool              `json:"debug"`
 }
 
 type DynamicEndpointsConfig struct {
-	CategoryPrefix   string            `json:"categoryPrefix"`
-	APIMap           map[string]string `json:"apiMap"`
-	RefreshIntervals map[string]string `json:"refreshIntervals"`
+	CategoryPrefix   string                       `json:"categoryPrefix"`
+	Discovery        string                       `json:"discovery"`
+	APIMap           map[string]string            `json:"apiMap"`
+	RefreshIntervals map[string]string            `json:"refreshIntervals"`
+	FieldFilters     map[string]FieldFilterConfig `json:"fieldFilters"`
+	MaxPages         map[string]int               `json:"maxPages"`
+	VirtualEvents    VirtualEventsConfig          `json:"virtualEvents"`
+	Requests         map[string]RequestConfig     `json:"requests"`
+	DataStores       DataStoresConfig             `json:"dataStores"`
+	Orphans          OrphansConfig                `json:"orphans"`
+	Policy           PolicyConfig                 `json:"policy"`
+}
+
+// PolicyConfig limits which endpoints the wikis may queue. Allow and Deny map
+// endpoint types to ID patterns (path.Match syntax); Page names an on-wiki JSON
+// page with more allow and deny lists.
+type PolicyConfig struct {
+	Allow        map[string][]string `json:"allow"`
+	Deny         map[string][]string `json:"deny"`
+	Page         string              `json:"page"`
+	MaxEndpoints int                 `json:"maxEndpoints"`
+	Quotas       map[string]int      `json:"quotas"`
+}
+
+// OrphansConfig controls cleanup of endpoints whose queue category stays empty.
+type OrphansConfig struct {
+	GracePeriod string `json:"gracePeriod"`
+	PageAction  string `json:"pageAction"`
+}
+
+type DataStoresConfig struct {
+	Ordered map[string]OrderedDataStoreConfig `json:"ordered"`
+	Entries map[string]DataStoreEntryConfig   `json:"entries"`
+}
+
+type OrderedDataStoreConfig struct {
+	UniverseID string `json:"universeId"`
+	DataStore  string `json:"dataStore"`
+	Scope      string `json:"scope"`
+	Limit      int    `json:"limit"`
+}
+
+type DataStoreEntryConfig struct {
+	UniverseID string `json:"universeId"`
+	DataStore  string `json:"dataStore"`
+	Scope      string `json:"scope"`
+	EntryKey   string `json:"entryKey"`
+}
+
+type RequestConfig struct {
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+type VirtualEventsConfig struct {
+	PastDays int `json:"pastDays"`
+}
+
+type FieldFilterConfig struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// DocFields defaults to using the documented fields as the allowlist when
+	// both Include and Exclude are empty.
+	DocFields *bool `json:"docFields"`
 }
 
 type OpenCloudConfig struct {
@@ -49,6 +155,39 @@ type RobloxConfig struct {
 	Cookie string `json:"cookie"`
 }
 
+const DefaultCredentialProfile = "default"
+
+// OpenCloudEndpointTypes are the endpoint types fetched from Open Cloud, which
+// need an API key.
+var OpenCloudEndpointTypes = []string{
+	"users", "groups", "universes", "places", "developer-products", "group-roles", "group-shout",
+	"ordered-datastores", "datastores",
+}
+
+type CredentialsConfig struct {
+	Profiles map[string]CredentialProfile `json:"profiles"`
+	Routes   []CredentialRoute            `json:"routes"`
+}
+
+type CredentialProfile struct {
+	APIKey string `json:"apiKey"`
+	Cookie string `json:"cookie"`
+}
+
+// CredentialRoute sends endpoints to a profile. Empty EndpointTypes matches
+// every type, and empty IDs and IDRanges match every ID.
+type CredentialRoute struct {
+	Profile       string    `json:"profile"`
+	EndpointTypes []string  `json:"endpointTypes"`
+	IDs           []string  `json:"ids"`
+	IDRanges      []IDRange `json:"idRanges"`
+}
+
+type IDRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.ReadFile(path)
 	if err != nil {
@@ -62,6 +201,52 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	seen := make(map[string]bool, len(config.Wikis))
+	for i, w := range config.Wikis {
+		if w.Name == "" || strings.ContainsAny(w.Name, `/\.`) {
+			return nil, fmt.Errorf("wiki %d needs a name without slashes or dots", i)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("duplicate wiki name %q", w.Name)
+		}
+		seen[w.Name] = true
+	}
+
+	for _, w := range config.GetWikis() {
+		switch w.Discovery {
+		case DiscoveryCategories, DiscoveryEmbeddedIn:
+		default:
+			return nil, fmt.Errorf("invalid discovery mode %q, expected %s or %s", w.Discovery, DiscoveryCategories, DiscoveryEmbeddedIn)
+		}
+	}
+
+	switch config.DynamicEndpoints.Orphans.PageAction {
+	case "", "keep", "mark", "delete":
+	default:
+		return nil, fmt.Errorf("invalid orphans.pageAction %q, expected keep, mark or delete", config.DynamicEndpoints.Orphans.PageAction)
+	}
+
+	for endpointType, patterns := range config.DynamicEndpoints.Policy.Allow {
+		if err := validatePatterns(patterns); err != nil {
+			return nil, fmt.Errorf("policy.allow.%s: %w", endpointType, err)
+		}
+	}
+	for endpointType, patterns := range config.DynamicEndpoints.Policy.Deny {
+		if err := validatePatterns(patterns); err != nil {
+			return nil, fmt.Errorf("policy.deny.%s: %w", endpointType, err)
+		}
+	}
+
+	for i, route := range config.Credentials.Routes {
+		profile, ok := config.Credentials.Profiles[route.Profile]
+		if !ok {
+			return nil, fmt.Errorf("credential route %d references unknown profile %q", i, route.Profile)
+		}
+		if route.Profile != DefaultCredentialProfile && profile.APIKey == "" && route.needsAPIKey() {
+			return nil, fmt.Errorf("credential route %d can match open cloud endpoints but profile %q has no apiKey", i, route.Profile)
+		}
+	}
+
 	return config, nil
 }
 
@@ -69,13 +254,158 @@ func (c *Config) GetCategoryCheckInterval() (time.Duration, error) {
 	return time.ParseDuration(c.Server.CategoryCheckInterval)
 }
 
+// GetFullScanInterval returns how often discovery rescans every queue title,
+// or 0 when every check is a full scan.
+func (c *Config) GetFullScanInterval() (time.Duration, error) {
+	if c.Server.FullScanInterval == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.Server.FullScanInterval)
+}
+
+func (c *Config) GetStatusInterval() (time.Duration, error) {
+	if c.Server.StatusInterval == "" {
+		return defaultStatusInterval, nil
+	}
+	return time.ParseDuration(c.Server.StatusInterval)
+}
+
 func (c *Config) GetDataRefreshInterval() (time.Duration, error) {
 	return time.ParseDuration(c.Server.DataRefreshInterval)
 }
 
+// GetDrainTimeout returns how long in-flight work may keep running after a
+// shutdown signal before it is aborted.
+func (c *Config) GetDrainTimeout() (time.Duration, error) {
+	if c.Server.DrainTimeout == "" {
+		return defaultDrainTimeout, nil
+	}
+	return time.ParseDuration(c.Server.DrainTimeout)
+}
+
+// GetFetchCacheTTL returns how long identical Roblox responses are reused.
+func (c *Config) GetFetchCacheTTL() (time.Duration, error) {
+	if c.Server.FetchCacheTTL == "" {
+		return defaultFetchCacheTTL, nil
+	}
+	return time.ParseDuration(c.Server.FetchCacheTTL)
+}
+
 func (c *Config) GetRefreshInterval(endpointType string) (time.Duration, error) {
 	if raw, ok := c.DynamicEndpoints.RefreshIntervals[endpointType]; ok && raw != "" {
 		return time.ParseDuration(raw)
 	}
 	return c.GetDataRefreshInterval()
 }
+
+func (c *Config) GetMaxPages(endpointType string) int {
+	if pages, ok := c.DynamicEndpoints.MaxPages[endpointType]; ok && pages > 0 {
+		return pages
+	}
+	return defaultMaxPages
+}
+
+func (c *Config) GetVirtualEventsPastWindow() time.Duration {
+	days := c.DynamicEndpoints.VirtualEvents.PastDays
+	if days <= 0 {
+		days = defaultVirtualEventsPastDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetOrphanGracePeriod returns how long a queue category may stay empty before
+// its endpoint is dropped, or 0 when orphan cleanup is disabled.
+func (c *Config) GetOrphanGracePeriod() (time.Duration, error) {
+	if c.DynamicEndpoints.Orphans.GracePeriod == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.DynamicEndpoints.Orphans.GracePeriod)
+}
+
+// CredentialsFor picks the profile of the first matching route, or the
+// "default" profile. A routed profile only uses its own credentials so a key
+// scoped to one creator is never swapped for another, while fields the default
+// profile leaves empty fall back to openCloud.apiKey and roblox.cookie.
+func (c *Config) CredentialsFor(endpointType, id string) (string, CredentialProfile) {
+	for _, route := range c.Credentials.Routes {
+		if route.matches(endpointType, id) {
+			return route.Profile, c.Credentials.Profiles[route.Profile]
+		}
+	}
+
+	profile := c.Credentials.Profiles[DefaultCredentialProfile]
+	profile.APIKey = cmp.Or(profile.APIKey, c.OpenCloud.APIKey)
+	profile.Cookie = cmp.Or(profile.Cookie, c.Roblox.Cookie)
+	return DefaultCredentialProfile, profile
+}
+
+// needsAPIKey reports whether the route can match an Open Cloud endpoint type.
+func (r CredentialRoute) needsAPIKey() bool {
+	if len(r.EndpointTypes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.EndpointTypes, func(endpointType string) bool {
+		return slices.Contains(OpenCloudEndpointTypes, endpointType)
+	})
+}
+
+func (r CredentialRoute) matches(endpointType, id string) bool {
+	if len(r.EndpointTypes) > 0 && !slices.Contains(r.EndpointTypes, endpointType) {
+		return false
+	}
+	if len(r.IDs) == 0 && len(r.IDRanges) == 0 {
+		return true
+	}
+	if slices.Contains(r.IDs, id) {
+		return true
+	}
+	numeric, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return false
+	}
+	for _, idRange := range r.IDRanges {
+		if numeric >= idRange.Min && numeric <= idRange.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWikis returns the configured wikis, or the single legacy "wiki" entry,
+// with the category prefix and Lua messages defaulting to the global ones.
+func (c *Config) GetWikis() []WikiConfig {
+	wikis := c.Wikis
+	if len(wikis) == 0 {
+		wikis = []WikiConfig{c.Wiki}
+	}
+
+	resolved := make([]WikiConfig, len(wikis))
+	for i, w := range wikis {
+		if w.CategoryPrefix == "" {
+			w.CategoryPrefix = c.DynamicEndpoints.CategoryPrefix
+		}
+		if w.Discovery == "" {
+			w.Discovery = c.DynamicEndpoints.Discovery
+		}
+		if w.Discovery == "" {
+			w.Discovery = DiscoveryCategories
+		}
+		if w.LuaMessages.QueueNote == "" {
+			w.LuaMessages.QueueNote = c.LuaMessages.QueueNote
+		}
+		if w.LuaMessages.FieldPathNotFound == "" {
+			w.LuaMessages.FieldPathNotFound = c.LuaMessages.FieldPathNotFound
+		}
+		resolved[i] = w
+	}
+	return resolved
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
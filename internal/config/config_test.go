@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialsFor(t *testing.T) {
+	cfg := &Config{
+		OpenCloud: OpenCloudConfig{APIKey: "legacy-key"},
+		Roblox:    RobloxConfig{Cookie: "legacy-cookie"},
+		Credentials: CredentialsConfig{
+			Profiles: map[string]CredentialProfile{
+				"default":  {APIKey: "default-key"},
+				"studio":   {APIKey: "studio-key", Cookie: "studio-cookie"},
+				"keyless":  {Cookie: "keyless-cookie"},
+				"thumbs":   {Cookie: "thumbs-cookie"},
+				"unrouted": {APIKey: "unrouted-key"},
+			},
+			Routes: []CredentialRoute{
+				{Profile: "studio", IDRanges: []IDRange{{Min: 100, Max: 199}}},
+				{Profile: "keyless", IDs: []string{"@Builderman"}},
+				{Profile: "thumbs", EndpointTypes: []string{"thumbnails"}, IDs: []string{"42"}},
+				{Profile: "unrouted", IDs: []string{"7"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		endpointType string
+		id           string
+		wantProfile  string
+		wantKey      string
+		wantCookie   string
+	}{
+		{name: "default profile falls back per field", endpointType: "users", id: "1", wantProfile: "default", wantKey: "default-key", wantCookie: "legacy-cookie"},
+		{name: "routed by id range", endpointType: "users", id: "150", wantProfile: "studio", wantKey: "studio-key", wantCookie: "studio-cookie"},
+		{name: "routed profile never borrows a key", endpointType: "users", id: "@Builderman", wantProfile: "keyless", wantCookie: "keyless-cookie"},
+		{name: "route limited to an endpoint type", endpointType: "thumbnails", id: "42", wantProfile: "thumbs", wantCookie: "thumbs-cookie"},
+		{name: "routed profile never borrows a cookie", endpointType: "users", id: "7", wantProfile: "unrouted", wantKey: "unrouted-key"},
+		{name: "route skipped for other types", endpointType: "badges", id: "42", wantProfile: "default", wantKey: "default-key", wantCookie: "legacy-cookie"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, creds := cfg.CredentialsFor(tt.endpointType, tt.id)
+			if profile != tt.wantProfile || creds.APIKey != tt.wantKey || creds.Cookie != tt.wantCookie {
+				t.Errorf("got %s %+v, want %s {APIKey:%s Cookie:%s}", profile, creds, tt.wantProfile, tt.wantKey, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestCredentialsForWithoutProfiles(t *testing.T) {
+	cfg := &Config{OpenCloud: OpenCloudConfig{APIKey: "key"}, Roblox: RobloxConfig{Cookie: "cookie"}}
+	profile, creds := cfg.CredentialsFor("users", "1")
+	if profile != DefaultCredentialProfile || creds.APIKey != "key" || creds.Cookie != "cookie" {
+		t.Errorf("got %s %+v", profile, creds)
+	}
+}
+
+func TestLoadConfigRoutedProfileNeedsAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  string
+		wantErr string
+	}{
+		{name: "all types", routes: `[{"profile": "cookie-only"}]`, wantErr: `profile "cookie-only" has no apiKey`},
+		{name: "open cloud type", routes: `[{"profile": "cookie-only", "endpointTypes": ["badges", "users"]}]`, wantErr: `profile "cookie-only" has no apiKey`},
+		{name: "legacy types only", routes: `[{"profile": "cookie-only", "endpointTypes": ["badges", "thumbnails"]}]`},
+		{name: "keyed profile", routes: `[{"profile": "keyed"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			content := `{"credentials": {"profiles": {"cookie-only": {"cookie": "c"}, "keyed": {"apiKey": "k"}}, "routes": ` + tt.routes + `}}`
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
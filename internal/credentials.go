@@ -0,0 +1,39 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+
+	"robloxapid/internal/config"
+)
+
+// credentialRoutingID returns the ID credential routes are matched against:
+// the universe for universe-scoped identifiers, otherwise the target ID.
+func credentialRoutingID(cfg *config.Config, endpointType, id string) string {
+	switch endpointType {
+	case "places":
+		universeID, _, _ := strings.Cut(id, "-")
+		return universeID
+	case "virtual-events":
+		if universeID, _, err := splitVirtualEventsID(id); err == nil {
+			return universeID
+		}
+	case "thumbnails":
+		if _, targetID, err := splitThumbnailID(id); err == nil {
+			return targetID
+		}
+	case "catalog":
+		if _, itemID, err := splitCatalogID(id); err == nil {
+			return strconv.FormatInt(itemID, 10)
+		}
+	case "ordered-datastores":
+		if store, ok := cfg.DynamicEndpoints.DataStores.Ordered[id]; ok {
+			return store.UniverseID
+		}
+	case "datastores":
+		if entry, ok := cfg.DynamicEndpoints.DataStores.Entries[id]; ok {
+			return entry.UniverseID
+		}
+	}
+	return id
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+
+	"robloxapid/internal/config"
+)
+
+const (
+	defaultOrderedDataStoreLimit = 10
+	orderedDataStoreMaxPageSize  = 100
+)
+
+// Datastore IDs are names declared in dynamicEndpoints.dataStores, so editors
+// can only reach the stores and keys an admin allowlisted.
+
+func orderedDataStorePath(cfg *config.Config, id string) (string, error) {
+	store, ok := cfg.DynamicEndpoints.DataStores.Ordered[id]
+	if !ok {
+		return "", fmt.Errorf("ordered datastore %q is not allowlisted in config", id)
+	}
+	if store.UniverseID == "" || store.DataStore == "" {
+		return "", fmt.Errorf("ordered datastore %q needs universeId and dataStore", id)
+	}
+
+	_, pageSize, _ := orderedDataStorePaging(store)
+	query := neturl.Values{}
+	query.Set("maxPageSize", fmt.Sprint(pageSize))
+	query.Set("orderBy", "value desc")
+	return fmt.Sprintf("universes/%s/ordered-data-stores/%s/scopes/%s/entries?%s",
+		neturl.PathEscape(store.UniverseID),
+		neturl.PathEscape(store.DataStore),
+		neturl.PathEscape(dataStoreScope(store.Scope)),
+		query.Encode(),
+	), nil
+}
+
+func orderedDataStorePaging(store config.OrderedDataStoreConfig) (limit, pageSize, pages int) {
+	limit = store.Limit
+	if limit <= 0 {
+		limit = defaultOrderedDataStoreLimit
+	}
+	pageSize = min(limit, orderedDataStoreMaxPageSize)
+	return limit, pageSize, (limit + pageSize - 1) / pageSize
+}
+
+// truncateOrderedEntries drops the entries past limit that the last page
+// brought in when limit isn't a multiple of the page size.
+func truncateOrderedEntries(data []byte, limit int) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unexpected ordered datastore response: %w", err)
+	}
+	var entries []json.RawMessage
+	if raw, ok := doc["orderedDataStoreEntries"]; ok {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("unexpected ordered datastore entries: %w", err)
+		}
+	}
+	if len(entries) <= limit {
+		return data, nil
+	}
+	raw, err := json.Marshal(entries[:limit])
+	if err != nil {
+		return nil, err
+	}
+	doc["orderedDataStoreEntries"] = raw
+	return json.Marshal(doc)
+}
+
+func dataStoreEntryPath(cfg *config.Config, id string) (string, error) {
+	entry, ok := cfg.DynamicEndpoints.DataStores.Entries[id]
+	if !ok {
+		return "", fmt.Errorf("datastore entry %q is not allowlisted in config", id)
+	}
+	if entry.UniverseID == "" || entry.DataStore == "" || entry.EntryKey == "" {
+		return "", fmt.Errorf("datastore entry %q needs universeId, dataStore and entryKey", id)
+	}
+
+	return fmt.Sprintf("universes/%s/data-stores/%s/scopes/%s/entries/%s",
+		neturl.PathEscape(entry.UniverseID),
+		neturl.PathEscape(entry.DataStore),
+		neturl.PathEscape(dataStoreScope(entry.Scope)),
+		neturl.PathEscape(entry.EntryKey),
+	), nil
+}
+
+func dataStoreScope(scope string) string {
+	if scope == "" {
+		return "global"
+	}
+	return scope
+}
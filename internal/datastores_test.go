@@ -0,0 +1,51 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+
+	"robloxapid/internal/config"
+)
+
+func TestOrderedDataStorePaging(t *testing.T) {
+	tests := []struct {
+		limit                  int
+		wantLimit, size, pages int
+	}{
+		{limit: 0, wantLimit: 10, size: 10, pages: 1},
+		{limit: 100, wantLimit: 100, size: 100, pages: 1},
+		{limit: 150, wantLimit: 150, size: 100, pages: 2},
+	}
+	for _, tt := range tests {
+		limit, size, pages := orderedDataStorePaging(config.OrderedDataStoreConfig{Limit: tt.limit})
+		if limit != tt.wantLimit || size != tt.size || pages != tt.pages {
+			t.Errorf("limit %d: got (%d, %d, %d), want (%d, %d, %d)", tt.limit, limit, size, pages, tt.wantLimit, tt.size, tt.pages)
+		}
+	}
+}
+
+func TestTruncateOrderedEntries(t *testing.T) {
+	data := []byte(`{"orderedDataStoreEntries":[{"id":"a"},{"id":"b"},{"id":"c"}],"nextPageToken":"t"}`)
+
+	got, err := truncateOrderedEntries(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Entries []struct{ ID string } `json:"orderedDataStoreEntries"`
+		Token   string                `json:"nextPageToken"`
+	}
+	if err := json.Unmarshal(got, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) != 2 || doc.Entries[1].ID != "b" || doc.Token != "t" {
+		t.Errorf("got %s", got)
+	}
+
+	if got, err := truncateOrderedEntries(data, 3); err != nil || string(got) != string(data) {
+		t.Errorf("data within the limit changed: %s, %v", got, err)
+	}
+	if _, err := truncateOrderedEntries([]byte(`[]`), 3); err == nil {
+		t.Error("expected an error for a non-object response")
+	}
+}
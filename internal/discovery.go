@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"robloxapid/internal/wiki"
+)
+
+// Discovery scans sites for queue titles. With a full scan interval set, scans
+// in between only look at pages changed since the previous scan, read from the
+// wiki's recent changes; full scans still catch what those miss, such as pages
+// re-rendered after a template edit.
+type Discovery struct {
+	fullScanInterval time.Duration
+
+	mu    sync.Mutex
+	sites map[*Site]*discoveryState
+}
+
+type discoveryState struct {
+	cursor   wiki.RCCursor
+	lastFull time.Time
+}
+
+func NewDiscovery(fullScanInterval time.Duration) *Discovery {
+	return &Discovery{fullScanInterval: fullScanInterval, sites: make(map[*Site]*discoveryState)}
+}
+
+// Scan returns the site's queue titles with their number of users, and whether
+// they come from a full scan. Incremental scans only return the titles used by
+// changed pages, with counts limited to those pages.
+func (d *Discovery) Scan(ctx context.Context, site *Site) (titles []wiki.Category, full bool, err error) {
+	d.mu.Lock()
+	state, ok := d.sites[site]
+	if !ok {
+		state = &discoveryState{}
+		d.sites[site] = state
+	}
+	d.mu.Unlock()
+
+	if d.fullScanInterval <= 0 {
+		titles, err = site.QueueTitles(ctx)
+		return titles, true, err
+	}
+
+	if state.lastFull.IsZero() || time.Since(state.lastFull) >= d.fullScanInterval {
+		// take the cursor first, so changes made during the scan are seen next time
+		cursor, err := site.Client.LatestChange(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		titles, err = site.QueueTitles(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		state.cursor = cursor
+		state.lastFull = time.Now()
+		return titles, true, nil
+	}
+
+	changed, cursor, err := site.Client.RecentChanges(ctx, state.cursor)
+	if err != nil {
+		return nil, false, err
+	}
+	slog.Debug("incremental discovery", "wiki", site.String(), "changed_pages", len(changed))
+	if len(changed) > 0 {
+		titles, err = site.ChangedQueueTitles(ctx, changed)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	state.cursor = cursor
+	return titles, false, nil
+}
@@ -0,0 +1,127 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"robloxapid/internal/metrics"
+)
+
+// sharedCall is one in-flight request that concurrent identical requests wait on.
+type sharedCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+type cachedResponse struct {
+	body    []byte
+	expires time.Time
+}
+
+// shared coalesces identical requests: concurrent callers share one network
+// call, and successful GET responses are reused for the configured TTL.
+var shared = struct {
+	sync.Mutex
+	ttl   time.Duration
+	calls map[string]*sharedCall
+	cache map[string]cachedResponse
+}{
+	calls: make(map[string]*sharedCall),
+	cache: make(map[string]cachedResponse),
+}
+
+type noCacheKey struct{}
+
+// WithoutCache marks requests made with ctx as needing a fresh response, so
+// they skip cached ones. Their response is still cached for later requests.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func SetCacheTTL(ttl time.Duration) {
+	shared.Lock()
+	defer shared.Unlock()
+	shared.ttl = ttl
+	if ttl <= 0 {
+		clear(shared.cache)
+	}
+}
+
+// doShared runs fn for r unless an identical request is cached or in flight.
+// A caller joining an in-flight request stops waiting when its own ctx ends.
+func doShared(ctx context.Context, r Request, fn func(context.Context, Request) ([]byte, error)) ([]byte, error) {
+	key := requestKey(r)
+	now := time.Now()
+	// only GETs are safe to replay from the cache, POST endpoints share in-flight calls only
+	cacheable := r.Method == http.MethodGet
+	skipCache, _ := ctx.Value(noCacheKey{}).(bool)
+
+	shared.Lock()
+	if cached, ok := shared.cache[key]; ok && cacheable && !skipCache {
+		if now.Before(cached.expires) {
+			shared.Unlock()
+			metrics.FetchShared.Inc("cached")
+			slog.Debug("reusing cached roblox response", "endpoint_type", r.EndpointType, "url", r.URL)
+			return slices.Clone(cached.body), nil
+		}
+		delete(shared.cache, key)
+	}
+	if call, ok := shared.calls[key]; ok {
+		shared.Unlock()
+		metrics.FetchShared.Inc("coalesced")
+		slog.Debug("joining identical roblox request", "endpoint_type", r.EndpointType, "url", r.URL)
+		select {
+		case <-call.done:
+			return slices.Clone(call.body), call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &sharedCall{done: make(chan struct{})}
+	shared.calls[key] = call
+	shared.Unlock()
+
+	call.body, call.err = fn(ctx, r)
+	close(call.done)
+
+	shared.Lock()
+	delete(shared.calls, key)
+	if call.err == nil && cacheable && shared.ttl > 0 {
+		expires := time.Now().Add(shared.ttl)
+		for k, cached := range shared.cache {
+			if !now.Before(cached.expires) {
+				delete(shared.cache, k)
+			}
+		}
+		shared.cache[key] = cachedResponse{body: call.body, expires: expires}
+	}
+	shared.Unlock()
+
+	return slices.Clone(call.body), call.err
+}
+
+// requestKey identifies a request by method, URL, body and credentials. The
+// credential profile name stands in for the auth headers when it is known.
+func requestKey(r Request) string {
+	h := sha256.New()
+	h.Write(r.Body)
+	if r.Profile == "" {
+		names := make([]string, 0, len(r.Headers))
+		for name := range r.Headers {
+			names = append(names, strings.ToLower(name)+"="+r.Headers[name])
+		}
+		slices.Sort(names)
+		for _, header := range names {
+			h.Write([]byte("\n" + header))
+		}
+	}
+	return strings.Join([]string{r.Method, r.URL, r.Profile, hex.EncodeToString(h.Sum(nil))}, " ")
+}
@@ -0,0 +1,124 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func countingFetch(calls *atomic.Int32) func(context.Context, Request) ([]byte, error) {
+	return func(ctx context.Context, r Request) ([]byte, error) {
+		calls.Add(1)
+		return []byte(`{"n":1}`), nil
+	}
+}
+
+func withCacheTTL(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	SetCacheTTL(ttl)
+	t.Cleanup(func() { SetCacheTTL(0) })
+}
+
+func TestDoSharedCachesGets(t *testing.T) {
+	withCacheTTL(t, time.Minute)
+	var calls atomic.Int32
+	r := Request{Method: http.MethodGet, URL: "https://example.com/get-cached"}
+
+	for range 3 {
+		if _, err := doShared(context.Background(), r, countingFetch(&calls)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+
+	other := r
+	other.Profile = "studio"
+	if _, err := doShared(context.Background(), other, countingFetch(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("another profile fetched %d times in total, want 2", got)
+	}
+}
+
+func TestDoSharedDoesNotCachePosts(t *testing.T) {
+	withCacheTTL(t, time.Minute)
+	var calls atomic.Int32
+	r := Request{Method: http.MethodPost, URL: "https://example.com/post", Body: []byte(`{"ids":[1]}`)}
+
+	for range 2 {
+		if _, err := doShared(context.Background(), r, countingFetch(&calls)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+}
+
+func TestDoSharedWithoutCache(t *testing.T) {
+	withCacheTTL(t, time.Minute)
+	var calls atomic.Int32
+	r := Request{Method: http.MethodGet, URL: "https://example.com/webhook"}
+
+	doShared(context.Background(), r, countingFetch(&calls))
+	doShared(WithoutCache(context.Background()), r, countingFetch(&calls))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+	// the fresh response replaces the cached one
+	doShared(context.Background(), r, countingFetch(&calls))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetched %d times after the fresh fetch, want 2", got)
+	}
+}
+
+func TestDoSharedCoalescesConcurrentRequests(t *testing.T) {
+	// late callers hit the cache instead, so there is one fetch either way
+	withCacheTTL(t, time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, r Request) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte(`{}`), nil
+	}
+	r := Request{Method: http.MethodGet, URL: "https://example.com/coalesce"}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() { doShared(context.Background(), r, fetch) })
+	}
+	for {
+		shared.Lock()
+		_, inFlight := shared.calls[requestKey(r)]
+		shared.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+}
+
+func TestDoSharedExpires(t *testing.T) {
+	withCacheTTL(t, 10*time.Millisecond)
+	var calls atomic.Int32
+	r := Request{Method: http.MethodGet, URL: "https://example.com/expires"}
+
+	doShared(context.Background(), r, countingFetch(&calls))
+	time.Sleep(20 * time.Millisecond)
+	doShared(context.Background(), r, countingFetch(&calls))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fetched %d times, want 2", got)
+	}
+}
@@ -1,51 +1,165 @@
 package fetcher
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"robloxapid/internal/metrics"
 )
 
 var client = &http.Client{
 	Timeout: 17 * time.Second,
 }
 
-func Fetch(url string) ([]byte, error) {
-	resp, err := client.Get(url)
+// csrfTokens remembers the last x-csrf-token handed out per host and session,
+// so only the first POST to a host with a given cookie pays for the handshake.
+var csrfTokens sync.Map
+
+type Request struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    []byte
+	// Profile names the credentials in Headers, so responses are only shared
+	// between requests made with the same credentials.
+	Profile string
+	// EndpointType only labels the request in metrics.
+	EndpointType string
+}
+
+func Fetch(ctx context.Context, url string) ([]byte, error) {
+	return Do(ctx, Request{Method: http.MethodGet, URL: url})
+}
+
+func FetchWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	return Do(ctx, Request{Method: http.MethodGet, URL: url, Headers: headers})
+}
+
+func PostWithHeaders(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	return Do(ctx, Request{Method: http.MethodPost, URL: url, Headers: headers, Body: body})
+}
+
+// Do sends r. Roblox rejects state-changing requests without a valid
+// x-csrf-token with 403 and a fresh token in the response headers, in which
+// case the request is retried once with that token.
+func Do(ctx context.Context, r Request) ([]byte, error) {
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	return doShared(ctx, r, do)
+}
+
+func do(ctx context.Context, r Request) ([]byte, error) {
+	host := requestHost(r.URL)
+	tokenKey := csrfKey(host, r)
+
+	var token string
+	if r.Method != http.MethodGet {
+		if cached, ok := csrfTokens.Load(tokenKey); ok {
+			token = cached.(string)
+		}
+	}
+
+	resp, err := send(ctx, r, token)
 	if err != nil {
 		return nil, err
 	}
+	if fresh := resp.Header.Get("x-csrf-token"); resp.StatusCode == http.StatusForbidden && fresh != "" && fresh != token {
+		resp.Body.Close()
+		csrfTokens.Store(tokenKey, fresh)
+		metrics.FetchCSRFRefreshes.Inc(host)
+		resp, err = send(ctx, r, fresh)
+		if err != nil {
+			return nil, err
+		}
+	}
 	defer resp.Body.Close()
 
-	return readResponseBody(url, resp)
+	return readResponseBody(r.URL, resp)
 }
 
-func FetchWithHeaders(url string, headers map[string]string) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func send(ctx context.Context, r Request, csrfToken string) (*http.Response, error) {
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL, body)
 	if err != nil {
 		return nil, err
 	}
-	for k, v := range headers {
+	if r.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range r.Headers {
 		if v != "" {
 			req.Header.Set(k, v)
 		}
 	}
+	if csrfToken != "" {
+		req.Header.Set("x-csrf-token", csrfToken)
+	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	elapsed := time.Since(start)
+	metrics.FetchRequests.Inc(r.EndpointType, req.URL.Host, status)
+	metrics.FetchDuration.Observe(elapsed.Seconds(), r.EndpointType, req.URL.Host)
+	slog.Debug("roblox request", "endpoint_type", r.EndpointType, "method", r.Method, "url", r.URL, "status", status, "duration", elapsed)
+	return resp, err
+}
+
+// csrfKey identifies the session a csrf token belongs to. Tokens are tied to
+// the cookie, which the credential profile names when it is known.
+func csrfKey(host string, r Request) string {
+	session := r.Profile
+	if session == "" {
+		for name, value := range r.Headers {
+			if strings.EqualFold(name, "Cookie") {
+				sum := sha256.Sum256([]byte(value))
+				session = hex.EncodeToString(sum[:])
+			}
+		}
+	}
+	return host + " " + session
+}
+
+func requestHost(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
 	if err != nil {
-		return nil, err
+		return rawURL
 	}
-	defer resp.Body.Close()
+	return parsed.Host
+}
+
+type StatusError struct {
+	StatusCode int
+	URL        string
+	Body       string
+}
 
-	return readResponseBody(url, resp)
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed (%d) for %s: %s", e.StatusCode, e.URL, e.Body)
 }
 
 func readResponseBody(url string, resp *http.Response) ([]byte, error) {
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("request failed (%d) for %s: %s", resp.StatusCode, url, strings.TrimSpace(string(body)))
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: url, Body: strings.TrimSpace(string(body))}
 	}
 	return io.ReadAll(resp.Body)
 }
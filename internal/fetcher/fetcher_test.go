@@ -0,0 +1,38 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDoKeepsCSRFTokensPerSession(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		want := "token-for-" + r.Header.Get("Cookie")
+		if r.Header.Get("x-csrf-token") != want {
+			w.Header().Set("x-csrf-token", want)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	studioA := Request{Method: http.MethodPost, URL: server.URL, Profile: "studio-a", Headers: map[string]string{"Cookie": "a"}, Body: []byte(`{}`)}
+	studioB := Request{Method: http.MethodPost, URL: server.URL, Profile: "studio-b", Headers: map[string]string{"Cookie": "b"}, Body: []byte(`{}`)}
+	unnamed := Request{Method: http.MethodPost, URL: server.URL, Headers: map[string]string{"Cookie": "c"}, Body: []byte(`{}`)}
+
+	// each session pays for one handshake, then reuses its own token
+	for _, r := range []Request{studioA, studioB, unnamed, studioA, studioB, unnamed} {
+		if _, err := Do(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := requests.Load(); got != 9 {
+		t.Errorf("sent %d requests, want 9", got)
+	}
+}
@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+)
+
+// cursorParams maps the cursor field of a paginated response to the query
+// parameter that requests the next page.
+var cursorParams = []struct {
+	field string
+	param string
+}{
+	{field: "nextPageCursor", param: "cursor"},
+	{field: "nextPageToken", param: "pageToken"},
+}
+
+// FetchPages sends r and follows its cursor for up to maxPages pages, merging
+// the list fields of every page into a single document.
+func FetchPages(ctx context.Context, r Request, maxPages int) ([]byte, error) {
+	url := r.URL
+	first, err := Do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(first, &merged); err != nil {
+		return first, nil
+	}
+
+	page := merged
+	fetched := 1
+	for ; fetched < maxPages; fetched++ {
+		param, cursor := nextCursor(page)
+		if cursor == "" {
+			break
+		}
+
+		pageURL, err := withQueryParam(url, param, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		pageReq := r
+		pageReq.URL = pageURL
+		body, err := Do(ctx, pageReq)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", fetched+1, err)
+		}
+
+		page = nil
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("page %d of %s is not a json object: %w", fetched+1, url, err)
+		}
+		if err := mergePage(merged, page); err != nil {
+			return nil, fmt.Errorf("page %d of %s: %w", fetched+1, url, err)
+		}
+	}
+
+	if fetched == 1 {
+		return first, nil
+	}
+	return json.Marshal(merged)
+}
+
+func nextCursor(page map[string]json.RawMessage) (param, cursor string) {
+	for _, c := range cursorParams {
+		raw, ok := page[c.field]
+		if !ok {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+			continue
+		}
+		return c.param, value
+	}
+	return "", ""
+}
+
+func withQueryParam(rawURL, param, value string) (string, error) {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	query.Set(param, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// mergePage appends the list fields of page to merged and carries the cursor
+// fields over, so the stored document records where pagination stopped.
+func mergePage(merged, page map[string]json.RawMessage) error {
+	for key, value := range page {
+		existing, ok := merged[key]
+		if !ok {
+			merged[key] = value
+			continue
+		}
+
+		var left, right []json.RawMessage
+		if json.Unmarshal(existing, &left) == nil && json.Unmarshal(value, &right) == nil {
+			combined, err := json.Marshal(append(left, right...))
+			if err != nil {
+				return err
+			}
+			merged[key] = combined
+			continue
+		}
+
+		for _, c := range cursorParams {
+			if key == c.field {
+				merged[key] = value
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package logging configures the daemon's log/slog logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"robloxapid/internal/config"
+)
+
+// Setup installs the logger described by cfg as the slog default, which also
+// routes the standard log package through it. The returned closer releases the
+// log file, if any.
+func Setup(cfg config.LoggingConfig) (io.Closer, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+		}
+	}
+
+	var out io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+	switch strings.ToLower(cfg.Output) {
+	case "", "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out, closer = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closer, nil
+}
@@ -0,0 +1,319 @@
+// Package metrics keeps the daemon's counters, gauges and histograms and
+// serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	FetchRequests = NewCounterVec("robloxapid_fetch_requests_total",
+		"Roblox API requests sent, by endpoint type, host and HTTP status (or error).",
+		"endpoint_type", "host", "status")
+	FetchDuration = NewHistogramVec("robloxapid_fetch_duration_seconds",
+		"Time until Roblox API response headers arrive.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 17},
+		"endpoint_type", "host")
+	FetchShared = NewCounterVec("robloxapid_fetch_shared_total",
+		"Roblox API requests answered without a network call, from the cache or by joining an identical request.",
+		"result")
+	FetchCSRFRefreshes = NewCounterVec("robloxapid_fetch_csrf_refreshes_total",
+		"Roblox x-csrf-token handshakes, by host.",
+		"host")
+
+	WikiEdits = NewCounterVec("robloxapid_wiki_edits_total",
+		"Wiki data page updates, by wiki and result (edited, unchanged or failed).",
+		"wiki", "result")
+	WikiPurges = NewCounterVec("robloxapid_wiki_purges_total",
+		"Wiki purge requests, by wiki and result.",
+		"wiki", "result")
+	WikiTokenRefreshes = NewCounterVec("robloxapid_wiki_token_refreshes_total",
+		"Wiki CSRF tokens fetched, by wiki.",
+		"wiki")
+
+	EndpointRefreshes = NewCounterVec("robloxapid_endpoint_refreshes_total",
+		"Endpoint refreshes, by endpoint type and result.",
+		"endpoint_type", "result")
+	EndpointDuration = NewHistogramVec("robloxapid_endpoint_refresh_duration_seconds",
+		"Time to fetch an endpoint and publish it to every wiki tracking it.",
+		[]float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		"endpoint_type")
+	EndpointLastSuccess = NewSinceVec("robloxapid_endpoint_seconds_since_last_success",
+		"Seconds since each endpoint was last refreshed successfully.",
+		"endpoint_type", "id")
+
+	QueueDepth = NewGaugeVec("robloxapid_refresh_queue_depth",
+		"Refresh tasks waiting for a worker.")
+	InFlight = NewGaugeVec("robloxapid_endpoints_in_flight",
+		"Endpoints currently being refreshed.")
+	TrackedEndpoints = NewGaugeVec("robloxapid_tracked_endpoints",
+		"Endpoints tracked through queue categories.")
+)
+
+func init() {
+	QueueDepth.Set(0)
+	InFlight.Set(0)
+	TrackedEndpoints.Set(0)
+}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var registry struct {
+	sync.Mutex
+	collectors []collector
+}
+
+func register(c collector) {
+	registry.Lock()
+	registry.collectors = append(registry.collectors, c)
+	registry.Unlock()
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.Lock()
+		collectors := slices.Clone(registry.collectors)
+		registry.Unlock()
+		for _, c := range collectors {
+			c.write(w)
+		}
+	})
+}
+
+// family holds the series of one metric, keyed by their label values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	counts []uint64
+	sum    float64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// check panics on a label count mismatch. It runs before f.mu is taken so a
+// bad call can't leave the family locked.
+func (f *family) check(values []string) {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+}
+
+// get returns the series for values; f.mu must be held and values checked.
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) delete(values []string) {
+	f.mu.Lock()
+	delete(f.series, strings.Join(values, "\xff"))
+	f.mu.Unlock()
+}
+
+// sorted returns a snapshot of the series in label order; f.mu must be held.
+func (f *family) sorted() []series {
+	out := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		snapshot := *s
+		snapshot.counts = slices.Clone(s.counts)
+		out = append(out, snapshot)
+	}
+	slices.SortFunc(out, func(a, b series) int { return slices.Compare(a.values, b.values) })
+	return out
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+func (f *family) labelString(values []string, extra ...string) string {
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type CounterVec struct{ f *family }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{f: newFamily(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(v float64, values ...string) {
+	c.f.check(values)
+	c.f.mu.Lock()
+	c.f.get(values).value += v
+	c.f.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.f.mu.Lock()
+	all := c.f.sorted()
+	c.f.mu.Unlock()
+	c.f.header(w)
+	for _, s := range all {
+		fmt.Fprintf(w, "%s%s %s\n", c.f.name, c.f.labelString(s.values), formatFloat(s.value))
+	}
+}
+
+type GaugeVec struct{ f *family }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{f: newFamily(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.f.check(values)
+	g.f.mu.Lock()
+	g.f.get(values).value = v
+	g.f.mu.Unlock()
+}
+
+func (g *GaugeVec) Add(v float64, values ...string) {
+	g.f.check(values)
+	g.f.mu.Lock()
+	g.f.get(values).value += v
+	g.f.mu.Unlock()
+}
+
+func (g *GaugeVec) Delete(values ...string) {
+	g.f.delete(values)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.f.mu.Lock()
+	all := g.f.sorted()
+	g.f.mu.Unlock()
+	g.f.header(w)
+	for _, s := range all {
+		fmt.Fprintf(w, "%s%s %s\n", g.f.name, g.f.labelString(s.values), formatFloat(s.value))
+	}
+}
+
+// SinceVec is a gauge reporting the seconds elapsed since a recorded time,
+// evaluated when scraped.
+type SinceVec struct{ f *family }
+
+func NewSinceVec(name, help string, labels ...string) *SinceVec {
+	s := &SinceVec{f: newFamily(name, help, "gauge", labels)}
+	register(s)
+	return s
+}
+
+func (s *SinceVec) Set(t time.Time, values ...string) {
+	s.f.check(values)
+	s.f.mu.Lock()
+	s.f.get(values).value = float64(t.UnixNano()) / float64(time.Second)
+	s.f.mu.Unlock()
+}
+
+func (s *SinceVec) Delete(values ...string) {
+	s.f.delete(values)
+}
+
+func (s *SinceVec) write(w io.Writer) {
+	s.f.mu.Lock()
+	all := s.f.sorted()
+	s.f.mu.Unlock()
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	s.f.header(w)
+	for _, series := range all {
+		fmt.Fprintf(w, "%s%s %s\n", s.f.name, s.f.labelString(series.values), formatFloat(now-series.value))
+	}
+}
+
+type HistogramVec struct {
+	f       *family
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{f: newFamily(name, help, "histogram", labels), buckets: buckets}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.f.check(values)
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.f.mu.Lock()
+	all := h.f.sorted()
+	h.f.mu.Unlock()
+	h.f.header(w)
+	for _, s := range all {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.f.name, h.f.labelString(s.values, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", h.f.name, h.f.labelString(s.values, "le", "+Inf"), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.f.name, h.f.labelString(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", h.f.name, h.f.labelString(s.values), formatFloat(s.value))
+	}
+}
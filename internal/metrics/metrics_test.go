@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func render(c collector) string {
+	var buf bytes.Buffer
+	c.write(&buf)
+	return buf.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A test counter.", "path", "status")
+	c.Inc(`C:\data "x"`+"\nnext", "200")
+	c.Add(2.5, "/a", "500")
+	c.Inc("/a", "500")
+
+	want := `# HELP test_counter_total A test counter.
+# TYPE test_counter_total counter
+test_counter_total{path="/a",status="500"} 3.5
+test_counter_total{path="C:\\data \"x\"\nnext",status="200"} 1
+`
+	if got := render(c); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeExposition(t *testing.T) {
+	g := NewGaugeVec("test_gauge", "A test gauge.", "wiki")
+	g.Set(4, "a")
+	g.Add(-1.5, "a")
+	g.Set(1, "b")
+	g.Delete("b")
+
+	want := `# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{wiki="a"} 2.5
+`
+	if got := render(g); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	unlabelled := NewGaugeVec("test_gauge_unlabelled", "No labels.")
+	unlabelled.Set(7)
+	if got := render(unlabelled); !strings.HasSuffix(got, "\ntest_gauge_unlabelled 7\n") {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A test histogram.", []float64{0.1, 1, 10}, "type")
+	for _, v := range []float64{0.05, 0.1, 0.5, 20} {
+		h.Observe(v, "games")
+	}
+
+	want := `# HELP test_duration_seconds A test histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{type="games",le="0.1"} 2
+test_duration_seconds_bucket{type="games",le="1"} 3
+test_duration_seconds_bucket{type="games",le="10"} 3
+test_duration_seconds_bucket{type="games",le="+Inf"} 4
+test_duration_seconds_sum{type="games"} 20.65
+test_duration_seconds_count{type="games"} 4
+`
+	if got := render(h); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSinceExposition(t *testing.T) {
+	s := NewSinceVec("test_seconds_since", "A test since gauge.", "id")
+	s.Set(time.Now().Add(-time.Hour), "1")
+	s.Set(time.Now(), "2")
+	s.Delete("2")
+
+	lines := strings.Split(strings.TrimSpace(render(s)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	value, ok := strings.CutPrefix(lines[2], `test_seconds_since{id="1"} `)
+	if !ok {
+		t.Fatalf("unexpected series line %q", lines[2])
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 3600 || seconds > 3660 {
+		t.Errorf("got %q seconds, want about an hour", value)
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	c := NewCounterVec("test_mismatch_total", "Mismatch.", "a", "b")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		c.Inc("only-one")
+	}()
+
+	// the family must still be usable after the bad call
+	done := make(chan string)
+	go func() {
+		c.Inc("x", "y")
+		done <- render(c)
+	}()
+	select {
+	case got := <-done:
+		if !strings.Contains(got, `test_mismatch_total{a="x",b="y"} 1`) {
+			t.Errorf("got\n%s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("family stayed locked after a label count mismatch")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	NewCounterVec("test_handler_total", "Served by the handler.", "x").Inc("y")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`test_handler_total{x="y"} 1`, "robloxapid_refresh_queue_depth 0", "# TYPE robloxapid_fetch_duration_seconds histogram"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
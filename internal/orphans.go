@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"robloxapid/internal/config"
+	"robloxapid/internal/storage"
+)
+
+// CleanupOrphan applies the configured page action to an orphaned endpoint's
+// data page and drops the site's local copy.
+func CleanupOrphan(ctx context.Context, cfg *config.Config, orphan Orphan) error {
+	slug := fmt.Sprintf("%s-%s.json", orphan.EndpointType, orphan.ID)
+	path := orphan.Site.dataPath(slug)
+	wikiTitle := orphan.Site.pageTitle(slug)
+	logger := slog.With("wiki", orphan.Site.String(), "category", orphan.Category, "wiki_title", wikiTitle)
+	reason := fmt.Sprintf("no page has used %s for longer than the orphan grace period", orphan.Category)
+
+	switch cfg.DynamicEndpoints.Orphans.PageAction {
+	case "mark":
+		data, err := storage.Load(path)
+		if os.IsNotExist(err) {
+			logger.Info("no local copy of orphaned data page, skipping mark")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		var dataMap map[string]json.RawMessage
+		if err := json.Unmarshal(data, &dataMap); err != nil {
+			return fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		dataMap["roOrphaned"] = json.RawMessage(fmt.Sprintf(`"%s"`, time.Now().UTC().Format(time.RFC3339)))
+		marked, err := json.MarshalIndent(dataMap, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := orphan.Site.Client.Push(ctx, wikiTitle, string(marked), "Marking orphaned data page: "+reason); err != nil {
+			return fmt.Errorf("error marking %s as orphaned: %w", wikiTitle, err)
+		}
+		logger.Info("marked orphaned data page")
+	case "delete":
+		if err := orphan.Site.Client.Delete(ctx, wikiTitle, "Orphaned data page: "+reason); err != nil {
+			return fmt.Errorf("error deleting %s: %w", wikiTitle, err)
+		}
+	default:
+		logger.Info("keeping orphaned data page")
+	}
+
+	if err := storage.Remove(path); err != nil {
+		return fmt.Errorf("error removing %s: %w", path, err)
+	}
+	return nil
+}
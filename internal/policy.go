@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"robloxapid/internal/config"
+)
+
+// anyType keys allow and deny lists applying to every endpoint type.
+const anyType = "*"
+
+// Policy decides which queued endpoints a site may track, from the config's
+// allow and deny lists plus those on the site's policy page, and remembers the
+// categories it rejected.
+type Policy struct {
+	cfg *config.Config
+
+	mu       sync.Mutex
+	pages    map[*Site]policyLists
+	rejected map[*Site]map[string]Rejection
+}
+
+type policyLists struct {
+	Allow map[string][]string `json:"allow"`
+	Deny  map[string][]string `json:"deny"`
+}
+
+// Rejection is a queue category the daemon refused to track, or could not parse
+// (without an endpoint type and ID).
+type Rejection struct {
+	Category     string    `json:"category"`
+	EndpointType string    `json:"endpointType,omitempty"`
+	ID           string    `json:"id,omitempty"`
+	Reason       string    `json:"reason"`
+	Since        time.Time `json:"since"`
+}
+
+func NewPolicy(cfg *config.Config) *Policy {
+	return &Policy{
+		cfg:      cfg,
+		pages:    make(map[*Site]policyLists),
+		rejected: make(map[*Site]map[string]Rejection),
+	}
+}
+
+// LoadPage reads the site's policy page. A missing page means no extra lists;
+// a page that fails to parse keeps the lists read before.
+func (p *Policy) LoadPage(ctx context.Context, site *Site) error {
+	title := p.cfg.DynamicEndpoints.Policy.Page
+	if title == "" {
+		return nil
+	}
+
+	var lists policyLists
+	content, err := site.Client.GetPageByName(ctx, title)
+	if err != nil && err.Error() != "page not found" {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(content), &lists); err != nil {
+			return fmt.Errorf("error parsing policy page %s: %w", title, err)
+		}
+	}
+
+	p.mu.Lock()
+	p.pages[site] = lists
+	p.mu.Unlock()
+	return nil
+}
+
+// Check reports why site may not track the endpoint, if it may not. Deny
+// patterns win; once a type has allow patterns, only matching IDs pass. The
+// policy page can only narrow the config: its denies are added, and its allow
+// patterns must match on top of the config's.
+func (p *Policy) Check(site *Site, endpointType, id string) error {
+	p.mu.Lock()
+	page := p.pages[site]
+	p.mu.Unlock()
+
+	cfg := p.cfg.DynamicEndpoints.Policy
+	deny := slices.Concat(cfg.Deny[endpointType], cfg.Deny[anyType], page.Deny[endpointType], page.Deny[anyType])
+	if pattern, ok := matchID(deny, id); ok {
+		return fmt.Errorf("%s %s is denied by %q", endpointType, id, pattern)
+	}
+	allow := slices.Concat(cfg.Allow[endpointType], cfg.Allow[anyType])
+	if _, ok := matchID(allow, id); len(allow) > 0 && !ok {
+		return fmt.Errorf("%s %s is not on the allowlist", endpointType, id)
+	}
+	pageAllow := slices.Concat(page.Allow[endpointType], page.Allow[anyType])
+	if _, ok := matchID(pageAllow, id); len(pageAllow) > 0 && !ok {
+		return fmt.Errorf("%s %s is not on the policy page allowlist", endpointType, id)
+	}
+	// an alias resolved before must also pass for the ID behind it
+	if canonical, ok := cachedAlias(endpointType, id); ok {
+		if err := p.Check(site, endpointType, canonical); err != nil {
+			return fmt.Errorf("%s resolves to %s: %w", id, canonical, err)
+		}
+	}
+	return nil
+}
+
+// AdmitAlias runs the checks a queued ID goes through on id, the canonical ID
+// the "@name" endpoint aliasID resolved to, for each target's site. Sites that
+// may not track id get the alias category rejected and stop tracking the alias.
+// When any site may, the resolution is recorded so the orphan sweep keeps the
+// canonical data page.
+func (p *Policy) AdmitAlias(s *Scheduler, targets []Target, endpointType, aliasID, id string) []Target {
+	var admitted []Target
+	for _, target := range targets {
+		err := p.Check(target.Site, endpointType, id)
+		if err == nil {
+			err = s.CanTrack(endpointType, id)
+		}
+		if err != nil {
+			p.Reject(target.Site, target.Category, endpointType, aliasID, fmt.Errorf("%s resolves to %s: %w", aliasID, id, err))
+			s.Untrack(target.Site, endpointType, aliasID)
+			continue
+		}
+		admitted = append(admitted, target)
+	}
+	if len(admitted) > 0 {
+		s.Resolve(endpointType, aliasID, id)
+	}
+	return admitted
+}
+
+// matchID matches id against path.Match patterns, ignoring case.
+func matchID(patterns []string, id string) (string, bool) {
+	id = strings.ToLower(id)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), id); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func (p *Policy) Reject(site *Site, category, endpointType, id string, reason error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rejected := p.rejected[site]
+	if rejected == nil {
+		rejected = make(map[string]Rejection)
+		p.rejected[site] = rejected
+	}
+	since := time.Now().UTC().Truncate(time.Second)
+	if previous, ok := rejected[category]; ok {
+		since = previous.Since
+	} else {
+		slog.Info("rejecting queue category", "wiki", site.String(), "category", category, "endpoint_type", endpointType, "id", id, "reason", reason)
+	}
+	rejected[category] = Rejection{Category: category, EndpointType: endpointType, ID: id, Reason: reason.Error(), Since: since}
+}
+
+// Accept forgets an earlier rejection of category.
+func (p *Policy) Accept(site *Site, category string) {
+	p.mu.Lock()
+	delete(p.rejected[site], category)
+	p.mu.Unlock()
+}
+
+// RetainRejections forgets the rejections of categories not in keep, after a
+// full scan found which ones are still used.
+func (p *Policy) RetainRejections(site *Site, keep map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	maps.DeleteFunc(p.rejected[site], func(category string, _ Rejection) bool {
+		return !keep[category]
+	})
+}
+
+// Rejections lists the site's rejected categories by title.
+func (p *Policy) Rejections(site *Site) []Rejection {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rejections := slices.Collect(maps.Values(p.rejected[site]))
+	slices.SortFunc(rejections, func(a, b Rejection) int { return strings.Compare(a.Category, b.Category) })
+	return rejections
+}
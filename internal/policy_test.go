@@ -0,0 +1,106 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"robloxapid/internal/config"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	cfg := &config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{Policy: config.PolicyConfig{
+		Allow: map[string][]string{"badges": {"1*"}},
+		Deny:  map[string][]string{"badges": {"13"}, "*": {"@Spam*"}},
+	}}}
+	p := NewPolicy(cfg)
+	site, paged := &Site{Name: "a"}, &Site{Name: "b"}
+	p.pages[paged] = policyLists{
+		Allow: map[string][]string{"badges": {"2*", "12"}, "*": {"@*"}},
+		Deny:  map[string][]string{"users": {"7"}},
+	}
+
+	tests := []struct {
+		site             *Site
+		endpointType, id string
+		wantErr          string
+	}{
+		{site: site, endpointType: "badges", id: "12"},
+		{site: site, endpointType: "badges", id: "13", wantErr: `denied by "13"`},
+		{site: site, endpointType: "badges", id: "21", wantErr: "not on the allowlist"},
+		{site: site, endpointType: "users", id: "21"},
+		{site: site, endpointType: "users", id: "@spammer", wantErr: `denied by "@Spam*"`},
+		{site: site, endpointType: "users", id: "@SPAMMER", wantErr: `denied by "@Spam*"`},
+		{site: site, endpointType: "groups", id: "@spam", wantErr: `denied by "@Spam*"`},
+		// the page narrows the config lists but can't widen them
+		{site: paged, endpointType: "badges", id: "12"},
+		{site: paged, endpointType: "badges", id: "11", wantErr: "not on the policy page allowlist"},
+		{site: paged, endpointType: "badges", id: "21", wantErr: "not on the allowlist"},
+		{site: paged, endpointType: "badges", id: "13", wantErr: `denied by "13"`},
+		{site: paged, endpointType: "users", id: "7", wantErr: `denied by "7"`},
+		{site: paged, endpointType: "users", id: "8", wantErr: "not on the policy page allowlist"},
+		{site: paged, endpointType: "users", id: "@Builderman"},
+		{site: site, endpointType: "users", id: "7"},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.site, tt.endpointType, tt.id)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s %s %s: got %v, want %q", tt.site, tt.endpointType, tt.id, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAdmitAlias(t *testing.T) {
+	cfg := &config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{Policy: config.PolicyConfig{
+		Deny: map[string][]string{"users": {"156"}},
+	}}}
+	p := NewPolicy(cfg)
+	s := NewScheduler(cfg)
+	site := &Site{Name: "a"}
+	category := "Category:roapid-users-@Builderman"
+	s.Track(site, category, "users", "@Builderman")
+
+	targets := []Target{{Site: site, Category: category}}
+	if admitted := p.AdmitAlias(s, targets, "users", "@Builderman", "156"); len(admitted) != 0 {
+		t.Fatalf("denied canonical ID admitted for %d targets", len(admitted))
+	}
+	if _, tracked := s.Lookup(EndpointKey("users", "@Builderman")); tracked {
+		t.Error("alias still tracked after its canonical ID was denied")
+	}
+	rejections := p.Rejections(site)
+	if len(rejections) != 1 || rejections[0].Category != category || !strings.Contains(rejections[0].Reason, "resolves to 156") {
+		t.Errorf("got rejections %+v", rejections)
+	}
+
+	if admitted := p.AdmitAlias(s, targets, "users", "@Roblox", "1"); len(admitted) != 1 {
+		t.Errorf("allowed canonical ID admitted for %d targets, want 1", len(admitted))
+	}
+
+	// once resolved, scans reject the alias without waiting for a refresh
+	aliasCache.Lock()
+	aliasCache.entries[aliasCacheKey("users", "Builderman")] = resolvedAlias{id: "156", name: "Builderman", resolvedAt: time.Now()}
+	aliasCache.Unlock()
+	t.Cleanup(func() {
+		aliasCache.Lock()
+		delete(aliasCache.entries, aliasCacheKey("users", "Builderman"))
+		aliasCache.Unlock()
+	})
+	if err := p.Check(site, "users", "@Builderman"); err == nil || !strings.Contains(err.Error(), "resolves to 156") {
+		t.Errorf("got %v for a cached alias of a denied ID", err)
+	}
+}
+
+func TestAdmitAliasQuota(t *testing.T) {
+	cfg := &config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{Policy: config.PolicyConfig{
+		Quotas: map[string]int{"users": 1},
+	}}}
+	p := NewPolicy(cfg)
+	s := NewScheduler(cfg)
+	site := &Site{Name: "a"}
+	s.Track(site, "Category:roapid-users-@Builderman", "users", "@Builderman")
+
+	targets := []Target{{Site: site, Category: "Category:roapid-users-@Builderman"}}
+	if admitted := p.AdmitAlias(s, targets, "users", "@Builderman", "156"); len(admitted) != 0 {
+		t.Error("canonical ID admitted past the users quota")
+	}
+}
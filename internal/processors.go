@@ -1,19 +1,26 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	neturl "net/url"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"robloxapid/internal/checker"
 	"robloxapid/internal/config"
 	"robloxapid/internal/fetcher"
+	"robloxapid/internal/metrics"
+	"robloxapid/internal/projection"
 	"robloxapid/internal/storage"
-	"robloxapid/internal/wiki"
 )
 
 type staticDoc struct {
@@ -68,185 +75,303 @@ var staticDocs = []staticDoc{
 		wikiSlug: "virtual-events.json",
 		summary:  "Automated sync of internal virtual events API guide",
 	},
+	{
+		filename: "universe-badges.json",
+		wikiSlug: "universe-badges.json",
+		summary:  "Automated sync of the guide to a universe's full badge list",
+	},
+	{
+		filename: "game-passes.json",
+		wikiSlug: "game-passes.json",
+		summary:  "Automated sync of the guide to a universe's game pass list",
+	},
+	{
+		filename: "game-pass.json",
+		wikiSlug: "game-pass.json",
+		summary:  "Automated sync of game pass product info usage guide",
+	},
+	{
+		filename: "developer-products.json",
+		wikiSlug: "developer-products.json",
+		summary:  "Automated sync of developer products usage guide",
+	},
+	{
+		filename: "group-roles.json",
+		wikiSlug: "group-roles.json",
+		summary:  "Automated sync of group roles usage guide",
+	},
+	{
+		filename: "group-games.json",
+		wikiSlug: "group-games.json",
+		summary:  "Automated sync of the guide to the experiences a group owns",
+	},
+	{
+		filename: "group-shout.json",
+		wikiSlug: "group-shout.json",
+		summary:  "Automated sync of group shout usage guide",
+	},
+	{
+		filename: "catalog.json",
+		wikiSlug: "catalog.json",
+		summary:  "Automated sync of catalog item details usage guide",
+	},
+	{
+		filename: "ordered-datastores.json",
+		wikiSlug: "ordered-datastores.json",
+		summary:  "Automated sync of ordered datastores usage guide",
+	},
+	{
+		filename: "datastores.json",
+		wikiSlug: "datastores.json",
+		summary:  "Automated sync of datastores usage guide",
+	},
+	{
+		filename: "thumbnails.json",
+		wikiSlug: "thumbnails.json",
+		summary:  "Automated sync of thumbnails API guide",
+	},
 }
 
 const iso8601Millis = "2006-01-02T15:04:05.000Z"
 
-func ProcessEndpoint(wikiClient *wiki.WikiClient, cfg *config.Config, endpointType, id, category string) error {
+// ProcessEndpoint fetches an endpoint once and publishes it to every target.
+// admit filters the targets of the ID an "@name" endpoint resolves to.
+func ProcessEndpoint(ctx context.Context, targets []Target, cfg *config.Config, admit AliasGate, endpointType, id string) error {
 	urlTemplate, ok := cfg.DynamicEndpoints.APIMap[endpointType]
 	if !ok {
 		return fmt.Errorf("unknown endpoint type: %s", endpointType)
 	}
 
-	url, err := formatEndpointURL(endpointType, id, urlTemplate)
+	if strings.HasPrefix(id, "@") {
+		return processAlias(ctx, targets, cfg, admit, endpointType, id)
+	}
+
+	url, err := formatEndpointURL(cfg, endpointType, id, urlTemplate)
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s-%s.json", endpointType, id)
+	slug := fmt.Sprintf("%s-%s.json", endpointType, id)
 
 	var newData []byte
 	var headers map[string]string
 
-	switch endpointType {
-	case "users", "groups", "universes", "places":
-		if cfg.OpenCloud.APIKey == "" {
-			return fmt.Errorf("open cloud api key required for %s", endpointType)
+	profileName, creds := cfg.CredentialsFor(endpointType, credentialRoutingID(cfg, endpointType, id))
+	if slices.Contains(config.OpenCloudEndpointTypes, endpointType) {
+		if creds.APIKey == "" {
+			return fmt.Errorf("open cloud api key required for %s (credential profile %q)", endpointType, profileName)
 		}
 		headers = map[string]string{
-			"x-api-key": cfg.OpenCloud.APIKey,
+			"x-api-key": creds.APIKey,
 			"Accept":    "application/json",
 		}
 	}
 
+	now := time.Now().UTC()
+	var eventWindow string
 	if endpointType == "virtual-events" {
-		parsedURL, err := neturl.Parse(url)
-		if err != nil {
-			return fmt.Errorf("invalid virtual-events url %s: %w", url, err)
+		if _, eventWindow, err = splitVirtualEventsID(id); err != nil {
+			return err
+		}
+		if url, err = virtualEventsURL(url, eventWindow, now, cfg); err != nil {
+			return err
 		}
-		query := parsedURL.Query()
-		query.Set("endsBefore", time.Now().UTC().Format(iso8601Millis))
-		parsedURL.RawQuery = query.Encode()
-		url = parsedURL.String()
 	}
 
-	if cfg.Roblox.Cookie != "" {
+	if creds.Cookie != "" {
 		if headers == nil {
 			headers = make(map[string]string)
 		}
-		headers["Cookie"] = cfg.Roblox.Cookie
+		headers["Cookie"] = creds.Cookie
 	}
 
-	if headers != nil {
-		newData, err = fetcher.FetchWithHeaders(url, headers)
-	} else {
-		newData, err = fetcher.Fetch(url)
+	req := fetcher.Request{URL: url, Headers: headers, Profile: profileName, EndpointType: endpointType}
+	switch endpointType {
+	case "thumbnails":
+		newData, err = fetchThumbnail(ctx, req, id)
+	case "catalog":
+		newData, err = fetchCatalogItem(ctx, req, id)
+	case "ordered-datastores":
+		limit, _, pages := orderedDataStorePaging(cfg.DynamicEndpoints.DataStores.Ordered[id])
+		if newData, err = fetcher.FetchPages(ctx, req, pages); err == nil {
+			newData, err = truncateOrderedEntries(newData, limit)
+		}
+	default:
+		if reqCfg, ok := cfg.DynamicEndpoints.Requests[endpointType]; ok {
+			var endpointReq fetcher.Request
+			if endpointReq, err = buildEndpointRequest(reqCfg, req, id); err == nil {
+				newData, err = fetcher.Do(ctx, endpointReq)
+			}
+		} else {
+			newData, err = fetcher.FetchPages(ctx, req, cfg.GetMaxPages(endpointType))
+		}
 	}
-
 	if err != nil {
+		var statusErr *fetcher.StatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("credential profile %q was refused for %s %s, check that its api key has the needed scopes: %w", profileName, endpointType, id, err)
+		}
 		return fmt.Errorf("error fetching data from %s: %w", url, err)
 	}
 
+	if eventWindow != "" {
+		newData, err = filterVirtualEvents(newData, eventWindow, now, cfg)
+		if err != nil {
+			return fmt.Errorf("error filtering %s events for %s: %w", eventWindow, slug, err)
+		}
+	}
+
+	if filter, ok := cfg.DynamicEndpoints.FieldFilters[endpointType]; ok {
+		newData, err = applyFieldFilter(endpointType, filter, newData)
+		if err != nil {
+			return fmt.Errorf("error filtering fields for %s: %w", slug, err)
+		}
+	}
+
+	return publishToTargets(ctx, targets, slug, url, newData)
+}
+
+func publishToTargets(ctx context.Context, targets []Target, slug, source string, newData []byte) error {
+	var errs []error
+	for _, target := range targets {
+		if err := publishEndpointData(ctx, target, slug, source, newData); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Site, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishEndpointData stores newData and pushes it to the target's data page
+// when it has meaningful changes (or the page is missing), then purges the
+// category members.
+func publishEndpointData(ctx context.Context, target Target, slug, source string, newData []byte) error {
+	wikiClient := target.Site.Client
+	path := target.Site.dataPath(slug)
+	wikiTitle := target.Site.pageTitle(slug)
+	category := target.Category
+	logger := slog.With("wiki", target.Site.String(), "category", category, "wiki_title", wikiTitle, "source", source)
+
 	hasChanged, err := checker.HasChanged(path, newData)
 	if err != nil {
 		return fmt.Errorf("error checking changes for %s: %w", path, err)
 	}
 
-	wikiTitle := fmt.Sprintf("%s:roapid/%s-%s.json", cfg.Wiki.Namespace, endpointType, id)
-
 	shouldPush := hasChanged
 	if !hasChanged {
-		exists, err := wikiClient.PageExists(wikiTitle)
+		exists, err := wikiClient.PageExists(ctx, wikiTitle)
 		if err != nil {
-			log.Printf("Error checking if %s exists: %v", wikiTitle, err)
+			logger.Error("error checking if data page exists", "err", err)
 		} else if !exists {
-			log.Printf("%s missing on wiki; forcing upload.", wikiTitle)
+			logger.Info("data page missing on wiki, forcing upload")
 			shouldPush = true
 		}
 	}
 
 	if !shouldPush {
-		log.Printf("No meaningful changes for %s (only roLastUpdated or none), skipping wiki push.", url)
+		metrics.WikiEdits.Inc(wikiClient.Host(), "unchanged")
+		logger.Info("no meaningful changes (only roLastUpdated or none), skipping wiki push")
 		return nil
 	}
 
-	log.Printf("Updating data for %s...", url)
+	logger.Debug("saving data", "path", path)
 	dataToPush, err := storage.Save(path, newData)
 	if err != nil {
 		return fmt.Errorf("error saving data to %s: %w", path, err)
 	}
 
-	log.Printf("Meaningful changes detected for %s, pushing to wiki.", url)
-	summary := fmt.Sprintf("Automated update from %s", url)
-	err = wikiClient.Push(wikiTitle, string(dataToPush), summary)
+	logger.Info("meaningful changes detected, pushing to wiki")
+	summary := fmt.Sprintf("Automated update from %s", source)
+	err = wikiClient.Push(ctx, wikiTitle, string(dataToPush), summary)
 	if err != nil {
 		return fmt.Errorf("error pushing to wiki for %s: %w", wikiTitle, err)
 	}
 
-	if err := wikiClient.PurgeCategoryMembers(category); err != nil {
-		log.Printf("Error purging pages for %s: %v", category, err)
+	if err := target.Site.purgeUsers(ctx, category); err != nil {
+		logger.Error("error purging pages using the endpoint", "err", err)
 	}
 
-	log.Printf("Successfully updated %s", wikiTitle)
+	logger.Info("successfully updated data page")
 	return nil
 }
 
-func ProcessAboutEndpoint(wikiClient *wiki.WikiClient, cfg *config.Config) error {
+func ProcessAboutEndpoint(ctx context.Context, site *Site) error {
 	const aboutFilename = "about.json"
 	localPath := filepath.Join("config", aboutFilename)
+	dataPath := site.dataPath(aboutFilename)
 
 	aboutJSON, err := os.ReadFile(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to read %s: %w", localPath, err)
 	}
 
-	hasChanged, err := checker.HasChanged(aboutFilename, aboutJSON)
+	hasChanged, err := checker.HasChanged(dataPath, aboutJSON)
 	if err != nil {
 		return fmt.Errorf("error checking changes for %s: %w", aboutFilename, err)
 	}
 	if !hasChanged {
-		log.Printf("%s unchanged; skipping wiki update.", aboutFilename)
+		slog.Debug("unchanged, skipping wiki update", "wiki", site.String(), "file", aboutFilename)
 		return nil
 	}
 
-	dataToPush, err := storage.Save(aboutFilename, aboutJSON)
+	dataToPush, err := storage.Save(dataPath, aboutJSON)
 	if err != nil {
 		return fmt.Errorf("error saving about data: %w", err)
 	}
 
-	wikiTitle := fmt.Sprintf("%s:roapid/about.json", cfg.Wiki.Namespace)
+	wikiTitle := site.pageTitle(aboutFilename)
 	summary := "Automated sync of about information"
-	if err := wikiClient.Push(wikiTitle, string(dataToPush), summary); err != nil {
+	if err := site.Client.Push(ctx, wikiTitle, string(dataToPush), summary); err != nil {
 		return fmt.Errorf("error pushing about page to wiki: %w", err)
 	}
 
-	if err := wikiClient.PurgePages([]string{wikiTitle}); err != nil {
-		log.Printf("Error purging %s: %v", wikiTitle, err)
+	if err := site.Client.PurgePages(ctx, []string{wikiTitle}); err != nil {
+		slog.Error("error purging page", "wiki", site.String(), "wiki_title", wikiTitle, "err", err)
 	}
 
-	log.Printf("Successfully synced %s", wikiTitle)
+	slog.Info("successfully synced page", "wiki", site.String(), "wiki_title", wikiTitle)
 	return nil
 }
 
-func processStaticDoc(wikiClient *wiki.WikiClient, cfg *config.Config, doc staticDoc) error {
+func processStaticDoc(ctx context.Context, site *Site, doc staticDoc) error {
 	localPath := filepath.Join("config", doc.filename)
+	dataPath := site.dataPath(doc.filename)
 
 	content, err := os.ReadFile(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to read %s: %w", localPath, err)
 	}
 
-	hasChanged, err := checker.HasChanged(doc.filename, content)
+	hasChanged, err := checker.HasChanged(dataPath, content)
 	if err != nil {
 		return fmt.Errorf("error checking changes for %s: %w", doc.filename, err)
 	}
 	if !hasChanged {
-		log.Printf("%s unchanged; skipping wiki update.", doc.filename)
+		slog.Debug("unchanged, skipping wiki update", "wiki", site.String(), "file", doc.filename)
 		return nil
 	}
 
-	dataToPush, err := storage.Save(doc.filename, content)
+	dataToPush, err := storage.Save(dataPath, content)
 	if err != nil {
 		return fmt.Errorf("error saving %s data: %w", doc.filename, err)
 	}
 
-	wikiTitle := fmt.Sprintf("%s:roapid/%s", cfg.Wiki.Namespace, doc.wikiSlug)
-	if err := wikiClient.Push(wikiTitle, string(dataToPush), doc.summary); err != nil {
+	wikiTitle := site.pageTitle(doc.wikiSlug)
+	if err := site.Client.Push(ctx, wikiTitle, string(dataToPush), doc.summary); err != nil {
 		return fmt.Errorf("error pushing %s to wiki: %w", doc.filename, err)
 	}
 
-	if err := wikiClient.PurgePages([]string{wikiTitle}); err != nil {
-		log.Printf("Error purging %s: %v", wikiTitle, err)
+	if err := site.Client.PurgePages(ctx, []string{wikiTitle}); err != nil {
+		slog.Error("error purging page", "wiki", site.String(), "wiki_title", wikiTitle, "err", err)
 	}
 
-	log.Printf("Successfully synced %s", wikiTitle)
+	slog.Info("successfully synced page", "wiki", site.String(), "wiki_title", wikiTitle)
 	return nil
 }
 
-func SyncStaticDocs(wikiClient *wiki.WikiClient, cfg *config.Config) error {
+func SyncStaticDocs(ctx context.Context, site *Site) error {
 	var firstErr error
 	for _, doc := range staticDocs {
-		if err := processStaticDoc(wikiClient, cfg, doc); err != nil {
-			log.Printf("Error syncing %s: %v", doc.filename, err)
+		if err := processStaticDoc(ctx, site, doc); err != nil {
+			slog.Error("error syncing static doc", "wiki", site.String(), "file", doc.filename, "err", err)
 			if firstErr == nil {
 				firstErr = err
 			}
@@ -255,8 +380,111 @@ func SyncStaticDocs(wikiClient *wiki.WikiClient, cfg *config.Config) error {
 	return firstErr
 }
 
-func formatEndpointURL(endpointType, id, template string) (string, error) {
+// applyFieldFilter projects data with the endpoint's filter. The documented
+// fields are the allowlist when the filter sets neither include nor exclude, and
+// are added to include when docFields is explicitly true.
+func applyFieldFilter(endpointType string, filter config.FieldFilterConfig, data []byte) ([]byte, error) {
+	include := filter.Include
+	explicit := filter.DocFields != nil
+	if (explicit && *filter.DocFields) || (!explicit && len(include) == 0 && len(filter.Exclude) == 0) {
+		fields, err := loadDocFields(endpointType)
+		switch {
+		case err != nil && explicit:
+			return nil, err
+		case err == nil:
+			include = append(slices.Clone(include), projection.Leaves(fields)...)
+		}
+	}
+	return projection.Apply(data, include, filter.Exclude)
+}
+
+func loadDocFields(endpointType string) ([]string, error) {
+	filename := endpointType + ".json"
+	idx := slices.IndexFunc(staticDocs, func(doc staticDoc) bool { return doc.filename == filename })
+	if idx < 0 {
+		return nil, fmt.Errorf("no documentation fields for %s", endpointType)
+	}
+
+	localPath := filepath.Join("config", staticDocs[idx].filename)
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	var doc struct {
+		Fields []string `json:"fields"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", localPath, err)
+	}
+	return doc.Fields, nil
+}
+
+// buildEndpointRequest fills the %s placeholders of a configured request body
+// with the ID: escaped inside JSON strings, and only as an integer elsewhere, so
+// an ID can never add values or break the JSON.
+func buildEndpointRequest(reqCfg config.RequestConfig, base fetcher.Request, id string) (fetcher.Request, error) {
+	headers := maps.Clone(reqCfg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	maps.Copy(headers, base.Headers)
+
+	var body []byte
+	if reqCfg.Body != "" {
+		var err error
+		if body, err = fillRequestBody(reqCfg.Body, id); err != nil {
+			return fetcher.Request{}, err
+		}
+	}
+
+	return fetcher.Request{
+		Method:       strings.ToUpper(reqCfg.Method),
+		URL:          base.URL,
+		Headers:      headers,
+		Body:         body,
+		Profile:      base.Profile,
+		EndpointType: base.EndpointType,
+	}, nil
+}
+
+func fillRequestBody(template, id string) ([]byte, error) {
+	escaped, _ := json.Marshal(id)
+	inner := escaped[1 : len(escaped)-1]
+
+	var body []byte
+	inString := false
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case inString && c == '\\' && i+1 < len(template):
+			body = append(body, c, template[i+1])
+			i++
+			continue
+		case c == '"':
+			inString = !inString
+		case c == '%' && i+1 < len(template) && template[i+1] == 's':
+			if inString {
+				body = append(body, inner...)
+			} else {
+				n, err := strconv.ParseUint(id, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("id %q must be numeric for this request body", id)
+				}
+				// canonical form, "007" is not a valid JSON number
+				body = strconv.AppendUint(body, n, 10)
+			}
+			i++
+			continue
+		}
+		body = append(body, c)
+	}
+	return body, nil
+}
+
+func formatEndpointURL(cfg *config.Config, endpointType, id, template string) (string, error) {
 	var formatArg string
+	var err error
 
 	switch endpointType {
 	case "places":
@@ -265,7 +493,35 @@ func formatEndpointURL(endpointType, id, template string) (string, error) {
 			return "", fmt.Errorf("invalid place identifier %q, expected universeId-placeId", id)
 		}
 		formatArg = fmt.Sprintf("universes/%s/places/%s", parts[0], parts[1])
+	case "virtual-events":
+		universeID, _, err := splitVirtualEventsID(id)
+		if err != nil {
+			return "", err
+		}
+		formatArg = universeID
+	case "thumbnails":
+		kind, targetID, err := splitThumbnailID(id)
+		if err != nil {
+			return "", err
+		}
+		return thumbnailURL(template, kind, []string{targetID}), nil
+	case "catalog":
+		if _, _, err := splitCatalogID(id); err != nil {
+			return "", err
+		}
+		return template, nil
+	case "ordered-datastores":
+		if formatArg, err = orderedDataStorePath(cfg, id); err != nil {
+			return "", err
+		}
+	case "datastores":
+		if formatArg, err = dataStoreEntryPath(cfg, id); err != nil {
+			return "", err
+		}
 	default:
+		if !strings.Contains(template, "%s") {
+			return template, nil
+		}
 		formatArg = id
 	}
 
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+
+	"robloxapid/internal/config"
+	"robloxapid/internal/fetcher"
+)
+
+func TestBuildEndpointRequestBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{name: "quoted placeholder", body: `{"usernames":["%s"]}`, id: "Builderman", want: `{"usernames":["Builderman"]}`},
+		{name: "quoted placeholder escapes quotes", body: `{"usernames":["%s"]}`, id: `a"],"x":["b`, want: `{"usernames":["a\"],\"x\":[\"b"]}`},
+		{name: "placeholder inside a longer string", body: `{"key":"prefix-%s"}`, id: `x\y`, want: `{"key":"prefix-x\\y"}`},
+		{name: "escaped quote keeps string state", body: `{"a":"\"%s","b":[%s]}`, id: "7", want: `{"a":"\"7","b":[7]}`},
+		{name: "bare numeric placeholder", body: `{"userIds":[%s]}`, id: "156", want: `{"userIds":[156]}`},
+		{name: "bare placeholder drops leading zeros", body: `{"userIds":[%s]}`, id: "007", want: `{"userIds":[7]}`},
+		{name: "bare placeholder rejects lists", body: `{"userIds":[%s]}`, id: "1,2,3", wantErr: true},
+		{name: "bare placeholder rejects quotes", body: `{"userIds":[%s]}`, id: `1"`, wantErr: true},
+		{name: "bare placeholder rejects negatives", body: `{"userIds":[%s]}`, id: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := buildEndpointRequest(config.RequestConfig{Method: "post", Body: tt.body}, fetcher.Request{URL: "https://example.com"}, tt.id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got body %s", req.Body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(req.Body) != tt.want {
+				t.Errorf("body = %s, want %s", req.Body, tt.want)
+			}
+			if !json.Valid(req.Body) {
+				t.Errorf("body %s is not valid JSON", req.Body)
+			}
+			if req.Method != "POST" || req.URL != "https://example.com" {
+				t.Errorf("unexpected request %+v", req)
+			}
+		})
+	}
+}
+
+func TestApplyFieldFilter(t *testing.T) {
+	// loadDocFields reads the index JSON from config/ relative to the repo root
+	t.Chdir("..")
+	yes, no := true, false
+	data := `{"id":1,"upVotes":2,"downVotes":3,"extra":4}`
+	tests := []struct {
+		name   string
+		filter config.FieldFilterConfig
+		want   string
+	}{
+		{name: "empty filter uses documented fields", want: `{"downVotes":3,"id":1,"upVotes":2}`},
+		{name: "exclude only keeps undocumented fields", filter: config.FieldFilterConfig{Exclude: []string{"upVotes"}}, want: `{"downVotes":3,"extra":4,"id":1}`},
+		{name: "blank include keeps everything", filter: config.FieldFilterConfig{Include: []string{""}}, want: `{"downVotes":3,"extra":4,"id":1,"upVotes":2}`},
+		{name: "include replaces documented fields", filter: config.FieldFilterConfig{Include: []string{"extra"}}, want: `{"extra":4}`},
+		{name: "docFields true adds to include", filter: config.FieldFilterConfig{Include: []string{"extra"}, DocFields: &yes}, want: `{"downVotes":3,"extra":4,"id":1,"upVotes":2}`},
+		{name: "docFields false keeps everything", filter: config.FieldFilterConfig{DocFields: &no}, want: `{"downVotes":3,"extra":4,"id":1,"upVotes":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyFieldFilter("votes", tt.filter, []byte(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var decoded any
+			if err := json.Unmarshal(got, &decoded); err != nil {
+				t.Fatalf("invalid JSON %s: %v", got, err)
+			}
+			normalized, _ := json.Marshal(decoded)
+			if string(normalized) != tt.want {
+				t.Errorf("got %s, want %s", normalized, tt.want)
+			}
+		})
+	}
+}
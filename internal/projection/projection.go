@@ -0,0 +1,142 @@
+package projection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Apply keeps only the JSON paths matched by include (everything when include
+// is empty) and then drops the paths matched by exclude. Paths are dot
+// separated, "n" matches any array element and "*" matches any key or element,
+// mirroring the notation used by the static docs fields lists.
+func Apply(data []byte, include, exclude []string) ([]byte, error) {
+	includePaths, excludePaths := splitPaths(include), splitPaths(exclude)
+	if includePaths == nil && excludePaths == nil {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var root map[string]any
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("projection expects a json object: %w", err)
+	}
+
+	projected := project(root, includePaths, excludePaths)
+	return json.Marshal(projected)
+}
+
+// splitPaths returns nil when no path is left after trimming, so a list of
+// blank paths keeps everything instead of nothing.
+func splitPaths(paths []string) [][]string {
+	var split [][]string
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		split = append(split, strings.Split(p, "."))
+	}
+	return split
+}
+
+// Leaves drops the paths that are parents of another path in the list, such as
+// "data" next to "data.n.id", since including a parent keeps its whole subtree.
+func Leaves(paths []string) []string {
+	var leaves []string
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		parent := false
+		for _, other := range paths {
+			if strings.HasPrefix(strings.TrimSpace(other), p+".") {
+				parent = true
+				break
+			}
+		}
+		if !parent {
+			leaves = append(leaves, p)
+		}
+	}
+	return leaves
+}
+
+func project(value any, include, exclude [][]string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			childInclude, keep := descend(include, key, false)
+			if !keep {
+				continue
+			}
+			childExclude, drop := descendExclude(exclude, key, false)
+			if drop {
+				continue
+			}
+			out[key] = project(child, childInclude, childExclude)
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, child := range v {
+			childInclude, keep := descend(include, "", true)
+			if !keep {
+				continue
+			}
+			childExclude, drop := descendExclude(exclude, "", true)
+			if drop {
+				continue
+			}
+			out = append(out, project(child, childInclude, childExclude))
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+func segmentMatches(segment, key string, isIndex bool) bool {
+	if segment == "*" {
+		return true
+	}
+	if isIndex {
+		return segment == "n"
+	}
+	return segment == key
+}
+
+func descend(include [][]string, key string, isIndex bool) ([][]string, bool) {
+	if include == nil {
+		return nil, true
+	}
+	var next [][]string
+	for _, path := range include {
+		if !segmentMatches(path[0], key, isIndex) {
+			continue
+		}
+		if len(path) == 1 {
+			return nil, true
+		}
+		next = append(next, path[1:])
+	}
+	return next, next != nil
+}
+
+func descendExclude(exclude [][]string, key string, isIndex bool) ([][]string, bool) {
+	var next [][]string
+	for _, path := range exclude {
+		if !segmentMatches(path[0], key, isIndex) {
+			continue
+		}
+		if len(path) == 1 {
+			return nil, true
+		}
+		next = append(next, path[1:])
+	}
+	return next, false
+}
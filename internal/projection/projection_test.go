@@ -0,0 +1,128 @@
+package projection
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const sample = `{
+	"nextPageCursor": "abc",
+	"data": [
+		{"id": 1, "name": "a", "thumbnails": [{"url": "x"}], "stats": {"visits": 10, "playing": 2}},
+		{"id": 2, "name": "b", "thumbnails": [], "stats": {"visits": 20, "playing": 0}}
+	]
+}`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    string
+	}{
+		{
+			name: "no filters keeps everything",
+			want: sample,
+		},
+		{
+			name:    "n matches array elements",
+			include: []string{"data.n.id"},
+			want:    `{"data": [{"id": 1}, {"id": 2}]}`,
+		},
+		{
+			name:    "star matches keys",
+			include: []string{"data.n.stats.*"},
+			want:    `{"data": [{"stats": {"visits": 10, "playing": 2}}, {"stats": {"visits": 20, "playing": 0}}]}`,
+		},
+		{
+			name:    "star matches array elements",
+			include: []string{"data.*.name"},
+			want:    `{"data": [{"name": "a"}, {"name": "b"}]}`,
+		},
+		{
+			name:    "n does not match object keys",
+			include: []string{"n"},
+			want:    `{}`,
+		},
+		{
+			name:    "including a parent keeps its subtree",
+			include: []string{"data.n.stats"},
+			want:    `{"data": [{"stats": {"visits": 10, "playing": 2}}, {"stats": {"visits": 20, "playing": 0}}]}`,
+		},
+		{
+			name:    "exclude applies after include",
+			include: []string{"data"},
+			exclude: []string{"data.n.thumbnails", "data.n.stats.playing"},
+			want:    `{"data": [{"id": 1, "name": "a", "stats": {"visits": 10}}, {"id": 2, "name": "b", "stats": {"visits": 20}}]}`,
+		},
+		{
+			name:    "exclude alone keeps everything else",
+			exclude: []string{"data", "missing.path"},
+			want:    `{"nextPageCursor": "abc"}`,
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{"data.n.id", "data.n.name"},
+			exclude: []string{"data.n.name"},
+			want:    `{"data": [{"id": 1}, {"id": 2}]}`,
+		},
+		{
+			name:    "blank include paths keep everything",
+			include: []string{"", "  "},
+			want:    sample,
+		},
+		{
+			name:    "missing include paths keep nothing",
+			include: []string{"missing"},
+			want:    `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(sample), tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyRejectsNonObjects(t *testing.T) {
+	if _, err := Apply([]byte(`[1, 2]`), []string{"n"}, nil); err == nil {
+		t.Fatal("expected an error for a top-level array")
+	}
+}
+
+func TestLeaves(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  []string
+	}{
+		{paths: []string{"data", "data.n.id", "data.n.name"}, want: []string{"data.n.id", "data.n.name"}},
+		{paths: []string{"nextPageToken", "developerProducts", "developerProducts.n.productId"}, want: []string{"nextPageToken", "developerProducts.n.productId"}},
+		{paths: []string{"id", "identity"}, want: []string{"id", "identity"}},
+		{paths: []string{"", " "}, want: nil},
+	}
+	for _, tt := range tests {
+		if got := Leaves(tt.paths); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Leaves(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
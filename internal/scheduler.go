@@ -1,20 +1,70 @@
 package app
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"robloxapid/internal/config"
+	"robloxapid/internal/metrics"
 )
 
+const (
+	// refreshJitter spreads refreshes of endpoints sharing an interval by up to
+	// this fraction of the interval.
+	refreshJitter = 0.1
+	// failedRetryDelay caps how long a failed endpoint waits before retrying.
+	failedRetryDelay = 5 * time.Minute
+	// SchedulerHeartbeat bounds how long the scheduler sleeps, so it keeps
+	// reporting liveness even with nothing due.
+	SchedulerHeartbeat = time.Minute
+)
+
+// EndpointState is keyed by EndpointKey and shared by every site tracking the
+// endpoint, so it is fetched once per refresh whatever the number of wikis.
 type EndpointState struct {
 	EndpointType string
+	ID           string
 	Interval     time.Duration
 	NextRun      time.Time
+	Categories   map[*Site]string
+	// EmptySince records since when a site's category has had no members.
+	EmptySince map[*Site]time.Time
+	// Canonical is the ID an "@name" endpoint last resolved to.
+	Canonical   string
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+
+	entry *timerEntry
+}
+
+// Orphan is a site's queue category that stayed empty past the grace period.
+type Orphan struct {
+	Site         *Site
+	Category     string
+	EndpointType string
+	ID           string
+}
+
+func EndpointKey(endpointType, id string) string {
+	return endpointType + "-" + id
+}
+
+func (s *EndpointState) Targets() []Target {
+	targets := make([]Target, 0, len(s.Categories))
+	for site, category := range s.Categories {
+		targets = append(targets, Target{Site: site, Category: category})
+	}
+	return targets
 }
 
 var categoryNormalizer = strings.NewReplacer(
@@ -30,18 +80,58 @@ var categoryNormalizer = strings.NewReplacer(
 	"\u202f", "", // nnbsp
 )
 
-func ParseCategory(category, prefix string) (endpointType, id string, err error) {
+func ParseCategory(category, prefix string, apiMap map[string]string) (endpointType, id string, err error) {
 	normalized := normalizeCategory(category)
 	expectedPrefix := "Category:" + prefix + "-"
 	if len(normalized) < len(expectedPrefix) || !strings.EqualFold(normalized[:len(expectedPrefix)], expectedPrefix) {
 		return "", "", fmt.Errorf("invalid category format: %s", category)
 	}
-	remainder := normalized[len(expectedPrefix):]
-	lastDash := strings.LastIndex(remainder, "-")
-	if lastDash <= 0 || lastDash == len(remainder)-1 {
+	endpointType, id, ok := splitEndpointKey(normalized[len(expectedPrefix):], apiMap)
+	if !ok {
 		return "", "", fmt.Errorf("invalid category format: %s", category)
 	}
-	return remainder[:lastDash], remainder[lastDash+1:], nil
+	return endpointType, id, nil
+}
+
+// ParseDataTitle parses a data page title, "<namespace>:roapid/<type>-<id>.json",
+// accepting only known endpoint types so documentation pages are skipped.
+func ParseDataTitle(title, namespace string, apiMap map[string]string) (endpointType, id string, err error) {
+	normalized := normalizeCategory(title)
+	expectedPrefix := namespace + ":roapid/"
+	if len(normalized) < len(expectedPrefix) || !strings.EqualFold(normalized[:len(expectedPrefix)], expectedPrefix) || !strings.HasSuffix(normalized, ".json") {
+		return "", "", fmt.Errorf("invalid data page title: %s", title)
+	}
+	endpointType, id, ok := splitEndpointKey(strings.TrimSuffix(normalized[len(expectedPrefix):], ".json"), apiMap)
+	if !ok {
+		return "", "", fmt.Errorf("invalid data page title: %s", title)
+	}
+	if _, known := apiMap[endpointType]; !known {
+		return "", "", fmt.Errorf("unknown endpoint type in data page title: %s", title)
+	}
+	return endpointType, id, nil
+}
+
+// splitEndpointKey splits "<type>-<id>" preferring the longest known endpoint
+// type, since both types (virtual-events) and ids (places, variants) may
+// contain dashes. Unknown types fall back to splitting on the last dash.
+func splitEndpointKey(key string, apiMap map[string]string) (endpointType, id string, ok bool) {
+	for known := range apiMap {
+		if len(known) <= len(endpointType) || len(key) <= len(known)+1 {
+			continue
+		}
+		if strings.EqualFold(key[:len(known)], known) && key[len(known)] == '-' {
+			endpointType = known
+		}
+	}
+	if endpointType != "" {
+		return endpointType, key[len(endpointType)+1:], true
+	}
+
+	lastDash := strings.LastIndex(key, "-")
+	if lastDash <= 0 || lastDash == len(key)-1 {
+		return "", "", false
+	}
+	return key[:lastDash], key[lastDash+1:], true
 }
 
 func normalizeCategory(category string) string {
@@ -49,53 +139,423 @@ func normalizeCategory(category string) string {
 	return categoryNormalizer.Replace(trimmed)
 }
 
-func UpdateSchedule(processed map[string]*EndpointState, mu *sync.Mutex, category, endpointType string, cfg *config.Config, next time.Time) {
-	var interval time.Duration
+// Scheduler tracks every endpoint and runs it when its NextRun comes up, along
+// with periodic jobs, from a single min-heap, sleeping until the earliest one is
+// due.
+type Scheduler struct {
+	cfg *config.Config
+
+	mu        sync.Mutex
+	endpoints map[string]*EndpointState
+	perType   map[string]int
+	queue     timerQueue
+	wake      chan struct{}
+}
+
+type periodicJob struct {
+	name     string
+	interval time.Duration
+	run      func()
+}
+
+// timerEntry is a heap slot for either an endpoint key or a periodic job.
+type timerEntry struct {
+	at    time.Time
+	index int
+	key   string
+	job   *periodicJob
+}
+
+type timerQueue []*timerEntry
+
+func (q timerQueue) Len() int           { return len(q) }
+func (q timerQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *timerQueue) Push(x any) {
+	entry := x.(*timerEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *timerQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*q = old[:len(old)-1]
+	return entry
+}
 
-	mu.Lock()
-	if state, ok := processed[category]; ok && state != nil && state.Interval > 0 {
-		interval = state.Interval
+func NewScheduler(cfg *config.Config) *Scheduler {
+	return &Scheduler{
+		cfg:       cfg,
+		endpoints: make(map[string]*EndpointState),
+		perType:   make(map[string]int),
+		wake:      make(chan struct{}, 1),
 	}
-	mu.Unlock()
+}
 
-	if interval == 0 {
-		var err error
-		interval, err = cfg.GetRefreshInterval(endpointType)
-		if err != nil {
-			log.Printf("Invalid refresh interval for %s: %v", endpointType, err)
-			if interval, err = cfg.GetDataRefreshInterval(); err != nil {
-				interval = time.Minute
-			}
+// Track records that site tracks the endpoint through category. It reports
+// whether the site was not tracking it before, and whether the endpoint already
+// has a refresh schedule.
+func (s *Scheduler) Track(site *Site, category, endpointType, id string) (isNewForSite, scheduled bool) {
+	key := EndpointKey(endpointType, id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.endpoints[key]
+	if !ok {
+		state = &EndpointState{EndpointType: endpointType, ID: id}
+		s.endpoints[key] = state
+		s.perType[endpointType]++
+		metrics.TrackedEndpoints.Set(float64(len(s.endpoints)))
+	}
+	if state.Categories == nil {
+		state.Categories = make(map[*Site]string)
+	}
+	_, tracked := state.Categories[site]
+	state.Categories[site] = category
+	return !tracked, !state.NextRun.IsZero()
+}
+
+// CanTrack reports why a new endpoint would exceed the configured cap on tracked
+// endpoints or its type's quota. Endpoints already tracked are always accepted.
+func (s *Scheduler) CanTrack(endpointType, id string) error {
+	policy := s.cfg.DynamicEndpoints.Policy
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[EndpointKey(endpointType, id)]; ok {
+		return nil
+	}
+	if policy.MaxEndpoints > 0 && len(s.endpoints) >= policy.MaxEndpoints {
+		return fmt.Errorf("the limit of %d tracked endpoints is reached", policy.MaxEndpoints)
+	}
+	if quota, ok := policy.Quotas[endpointType]; ok && s.perType[endpointType] >= quota {
+		return fmt.Errorf("the quota of %d %s endpoints is reached", quota, endpointType)
+	}
+	return nil
+}
+
+// Untrack stops site tracking the endpoint, dropping it from the schedule when
+// no other site tracks it.
+func (s *Scheduler) Untrack(site *Site, endpointType, id string) {
+	key := EndpointKey(endpointType, id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.endpoints[key]
+	if !ok {
+		return
+	}
+	delete(state.Categories, site)
+	delete(state.EmptySince, site)
+	if len(state.Categories) == 0 {
+		s.forget(key, state)
+	}
+}
+
+// Lookup returns a copy of the endpoint's state.
+func (s *Scheduler) Lookup(key string) (EndpointState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.endpoints[key]
+	if !ok {
+		return EndpointState{}, false
+	}
+	return state.snapshot(), true
+}
+
+// SiteEndpoints returns copies of the states of the endpoints site tracks, by
+// key.
+func (s *Scheduler) SiteEndpoints(site *Site) []EndpointState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []EndpointState
+	for _, state := range s.endpoints {
+		if _, ok := state.Categories[site]; ok {
+			states = append(states, state.snapshot())
+		}
+	}
+	slices.SortFunc(states, func(a, b EndpointState) int {
+		return strings.Compare(EndpointKey(a.EndpointType, a.ID), EndpointKey(b.EndpointType, b.ID))
+	})
+	return states
+}
+
+func (s *EndpointState) snapshot() EndpointState {
+	snapshot := *s
+	snapshot.Categories = maps.Clone(s.Categories)
+	snapshot.EmptySince = maps.Clone(s.EmptySince)
+	snapshot.entry = nil
+	return snapshot
+}
+
+func (s *Scheduler) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Collect(maps.Keys(s.endpoints))
+}
+
+// Reschedule records the outcome of a refresh and queues the endpoint's next
+// one: a full, jittered interval after a success, or sooner after a failure.
+func (s *Scheduler) Reschedule(endpointType, id string, err error) {
+	now := time.Now()
+	s.mu.Lock()
+	if state, ok := s.endpoints[EndpointKey(endpointType, id)]; ok {
+		if err == nil {
+			state.LastSuccess = now
+			state.LastError = ""
+			state.LastErrorAt = time.Time{}
+		} else {
+			state.LastError = err.Error()
+			state.LastErrorAt = now
 		}
 	}
+	s.mu.Unlock()
 
-	if next.IsZero() {
-		next = time.Now().Add(interval)
+	interval := s.interval(endpointType, id)
+	delay := interval
+	if err == nil {
+		if spread := int64(float64(interval) * refreshJitter); spread > 0 {
+			delay += time.Duration(rand.Int64N(spread))
+		}
+	} else {
+		delay = min(interval, failedRetryDelay)
 	}
+	s.ScheduleAt(endpointType, id, now.Add(delay))
+}
+
+// Resolve records the ID the "@name" endpoint aliasID resolved to, whose data
+// page the alias page points at.
+func (s *Scheduler) Resolve(endpointType, aliasID, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.endpoints[EndpointKey(endpointType, aliasID)]; ok {
+		state.Canonical = id
+	}
+}
 
-	mu.Lock()
-	state, ok := processed[category]
+// ScheduleAt queues the endpoint's next refresh at next.
+func (s *Scheduler) ScheduleAt(endpointType, id string, next time.Time) {
+	key := EndpointKey(endpointType, id)
+
+	s.mu.Lock()
+	state, ok := s.endpoints[key]
 	if !ok {
-		state = new(EndpointState)
-		processed[category] = state
+		// untracked while it was refreshing
+		s.mu.Unlock()
+		return
 	}
-	state.EndpointType = endpointType
-	state.Interval = interval
 	state.NextRun = next
-	mu.Unlock()
+	if state.entry != nil && state.entry.index >= 0 {
+		state.entry.at = next
+		heap.Fix(&s.queue, state.entry.index)
+	} else {
+		state.entry = &timerEntry{at: next, key: key}
+		heap.Push(&s.queue, state.entry)
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// SweepOrphans updates how long each of site's categories has been empty, given
+// the member counts of its latest scan keyed by EndpointKey (missing keys count
+// as empty). Categories empty for longer than grace stop being tracked for the
+// site, and endpoints no site tracks any more are dropped from the schedule.
+// Endpoints an alias the site tracks resolved to are kept, since the alias page
+// points at their data page. A scan without any queue title is taken as a
+// broken listing rather than every category emptying at once, and is skipped.
+func (s *Scheduler) SweepOrphans(site *Site, members map[string]int, grace time.Duration, now time.Time) []Orphan {
+	if len(members) == 0 {
+		slog.Warn("scan found no queue titles, skipping orphan sweep", "wiki", site.String())
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliased := make(map[string]bool)
+	for _, state := range s.endpoints {
+		if _, ok := state.Categories[site]; ok && state.Canonical != "" {
+			aliased[EndpointKey(state.EndpointType, state.Canonical)] = true
+		}
+	}
+
+	var orphans []Orphan
+	for key, state := range s.endpoints {
+		category, ok := state.Categories[site]
+		if !ok {
+			continue
+		}
+		if members[key] > 0 || aliased[key] {
+			delete(state.EmptySince, site)
+			continue
+		}
+		if state.EmptySince == nil {
+			state.EmptySince = make(map[*Site]time.Time)
+		}
+		since, ok := state.EmptySince[site]
+		if !ok {
+			state.EmptySince[site] = now
+			continue
+		}
+		if now.Sub(since) < grace {
+			continue
+		}
+
+		delete(state.Categories, site)
+		delete(state.EmptySince, site)
+		orphans = append(orphans, Orphan{Site: site, Category: category, EndpointType: state.EndpointType, ID: state.ID})
+		if len(state.Categories) == 0 {
+			s.forget(key, state)
+		}
+	}
+	return orphans
+}
+
+// forget drops an endpoint from the schedule; s.mu must be held.
+func (s *Scheduler) forget(key string, state *EndpointState) {
+	if state.entry != nil && state.entry.index >= 0 {
+		heap.Remove(&s.queue, state.entry.index)
+	}
+	delete(s.endpoints, key)
+	s.perType[state.EndpointType]--
+	metrics.TrackedEndpoints.Set(float64(len(s.endpoints)))
+	metrics.EndpointLastSuccess.Delete(state.EndpointType, state.ID)
+}
+
+// Every runs fn every interval, counted from the end of its previous run, so a
+// slow run delays the next one instead of overlapping it.
+func (s *Scheduler) Every(name string, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	heap.Push(&s.queue, &timerEntry{
+		at:  time.Now().Add(interval),
+		job: &periodicJob{name: name, interval: interval, run: fn},
+	})
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Scheduler) interval(endpointType, id string) time.Duration {
+	s.mu.Lock()
+	state, ok := s.endpoints[EndpointKey(endpointType, id)]
+	if ok && state.Interval > 0 {
+		s.mu.Unlock()
+		return state.Interval
+	}
+	s.mu.Unlock()
+
+	interval, err := s.cfg.GetRefreshInterval(endpointType)
+	if err != nil {
+		slog.Warn("invalid refresh interval", "endpoint_type", endpointType, "err", err)
+		if interval, err = s.cfg.GetDataRefreshInterval(); err != nil {
+			interval = time.Minute
+		}
+	}
+
+	s.mu.Lock()
+	if state, ok := s.endpoints[EndpointKey(endpointType, id)]; ok {
+		state.Interval = interval
+	}
+	s.mu.Unlock()
+	return interval
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
 }
 
-func BootstrapFromData(processed map[string]*EndpointState, mu *sync.Mutex, cfg *config.Config) {
-	entries, err := os.ReadDir("data")
+// Run sleeps until the earliest entry is due, then hands due endpoint keys to
+// dispatch and starts due jobs, each on workers. dispatch may block until a
+// worker pool takes the keys. Endpoints leave the queue when dispatched and
+// come back through Reschedule. beat is called on every wake-up.
+func (s *Scheduler) Run(ctx context.Context, workers *sync.WaitGroup, dispatch func(keys []string), beat func()) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		beat()
+
+		now := time.Now()
+		var due []string
+		var jobs []*periodicJob
+		s.mu.Lock()
+		for s.queue.Len() > 0 && !s.queue[0].at.After(now) {
+			entry := heap.Pop(&s.queue).(*timerEntry)
+			if entry.job != nil {
+				jobs = append(jobs, entry.job)
+			} else {
+				due = append(due, entry.key)
+			}
+		}
+		sleep := SchedulerHeartbeat
+		if s.queue.Len() > 0 {
+			sleep = min(sleep, s.queue[0].at.Sub(now))
+		}
+		s.mu.Unlock()
+
+		if len(due) > 0 {
+			workers.Go(func() { dispatch(due) })
+		}
+		for _, job := range jobs {
+			workers.Go(func() {
+				job.run()
+				if ctx.Err() != nil {
+					return
+				}
+				s.mu.Lock()
+				heap.Push(&s.queue, &timerEntry{at: time.Now().Add(job.interval), job: job})
+				s.mu.Unlock()
+				s.notify()
+			})
+		}
+
+		timer.Reset(sleep)
+		select {
+		case <-ctx.Done():
+			slog.Info("scheduler stopping")
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Bootstrap tracks the endpoints every site already has local data for and
+// queues them to refresh right away, skipping those the policy or the caps
+// would refuse from a queue category.
+func (s *Scheduler) Bootstrap(sites []*Site, policy *Policy) {
+	count := 0
+	for _, site := range sites {
+		count += s.bootstrapSite(site, policy)
+	}
+	slog.Debug("bootstrap scheduled endpoints from existing data files", "count", count)
+}
+
+func (s *Scheduler) bootstrapSite(site *Site, policy *Policy) int {
+	entries, err := os.ReadDir(site.DataDir())
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Printf("[DEBUG] bootstrap: data directory not found; nothing to schedule yet")
-			return
+			slog.Debug("bootstrap found no data directory, nothing to schedule yet", "wiki", site.String())
+			return 0
 		}
-		log.Printf("[ERROR] bootstrap: cannot read data directory: %v", err)
-		return
+		slog.Error("bootstrap cannot read data directory", "wiki", site.String(), "err", err)
+		return 0
 	}
 
+	apiMap := s.cfg.DynamicEndpoints.APIMap
 	count := 0
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -106,29 +566,30 @@ func BootstrapFromData(processed map[string]*EndpointState, mu *sync.Mutex, cfg
 			continue
 		}
 		base := strings.TrimSuffix(name, ".json")
-		parts := strings.SplitN(base, "-", 2)
-		if len(parts) != 2 {
+		endpointType, id, ok := splitEndpointKey(base, apiMap)
+		if !ok {
 			continue
 		}
-
-		endpointType, id := parts[0], parts[1]
-		if id == "" {
+		if _, known := apiMap[endpointType]; !known {
+			continue
+		}
+		err := policy.Check(site, endpointType, id)
+		if err == nil {
+			err = s.CanTrack(endpointType, id)
+		}
+		if err != nil {
+			slog.Info("bootstrap skipping endpoint", "endpoint_type", endpointType, "id", id, "wiki", site.String(), "reason", err)
 			continue
 		}
 
-		category := fmt.Sprintf("Category:%s-%s-%s", cfg.DynamicEndpoints.CategoryPrefix, endpointType, id)
-
-		mu.Lock()
-		_, exists := processed[category]
-		mu.Unlock()
-		if exists {
+		isNewForSite, scheduled := s.Track(site, site.QueueTitle(endpointType, id), endpointType, id)
+		if !isNewForSite || scheduled {
 			continue
 		}
 
-		log.Printf("[DEBUG] bootstrap: scheduling %s from %s", category, name)
-		UpdateSchedule(processed, mu, category, endpointType, cfg, time.Now())
+		slog.Debug("bootstrap scheduling endpoint", "endpoint_type", endpointType, "id", id, "wiki", site.String(), "file", name)
+		s.ScheduleAt(endpointType, id, time.Now())
 		count++
 	}
-
-	log.Printf("[DEBUG] bootstrap: scheduled %d endpoints from existing data files", count)
+	return count
 }
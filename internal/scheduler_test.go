@@ -0,0 +1,145 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"robloxapid/internal/config"
+)
+
+func newTestScheduler() *Scheduler {
+	return NewScheduler(&config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{RefreshIntervals: map[string]string{"badges": "1h"}}})
+}
+
+func TestRescheduleClearsErrorOnSuccess(t *testing.T) {
+	s := newTestScheduler()
+	site := &Site{Name: "a"}
+	s.Track(site, "Category:roapid-badges-1", "badges", "1")
+
+	s.Reschedule("badges", "1", errors.New("boom"))
+	state, _ := s.Lookup(EndpointKey("badges", "1"))
+	if state.LastError != "boom" || state.LastErrorAt.IsZero() {
+		t.Fatalf("failure not recorded: %+v", state)
+	}
+
+	s.Reschedule("badges", "1", nil)
+	state, _ = s.Lookup(EndpointKey("badges", "1"))
+	if state.LastError != "" || !state.LastErrorAt.IsZero() || state.LastSuccess.IsZero() {
+		t.Errorf("recovered endpoint still reports an error: %+v", state)
+	}
+}
+
+func TestSweepOrphansKeepsAliasedPages(t *testing.T) {
+	s := newTestScheduler()
+	site := &Site{Name: "a"}
+	s.Track(site, "Category:roapid-users-@Builderman", "users", "@Builderman")
+	// bootstrap tracks the canonical page under a category nobody uses
+	s.Track(site, "Category:roapid-users-156", "users", "156")
+	s.Resolve("users", "@Builderman", "156")
+
+	members := map[string]int{EndpointKey("users", "@Builderman"): 1}
+	start := time.Now()
+	for _, now := range []time.Time{start, start.Add(2 * time.Hour)} {
+		if orphans := s.SweepOrphans(site, members, time.Hour, now); len(orphans) != 0 {
+			t.Fatalf("got orphans %+v", orphans)
+		}
+	}
+
+	s.Untrack(site, "users", "@Builderman")
+	members = map[string]int{EndpointKey("users", "@Builderman"): 0}
+	s.SweepOrphans(site, members, time.Hour, start.Add(3*time.Hour))
+	orphans := s.SweepOrphans(site, members, time.Hour, start.Add(5*time.Hour))
+	if len(orphans) != 1 || orphans[0].ID != "156" {
+		t.Errorf("got orphans %+v once the alias is gone, want users 156", orphans)
+	}
+}
+
+func TestSweepOrphans(t *testing.T) {
+	s := newTestScheduler()
+	site, other := &Site{Name: "a"}, &Site{Name: "b"}
+	for _, id := range []string{"1", "2", "3"} {
+		s.Track(site, "Category:roapid-badges-"+id, "badges", id)
+		s.ScheduleAt("badges", id, time.Now())
+	}
+	s.Track(other, "Category:roapid-badges-1", "badges", "1")
+
+	start := time.Now()
+	grace := time.Hour
+	sweep := func(members map[string]int, now time.Time) []string {
+		var ids []string
+		for _, orphan := range s.SweepOrphans(site, members, grace, now) {
+			ids = append(ids, orphan.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	// 1 and 2 turn empty, 3 keeps its members
+	members := map[string]int{EndpointKey("badges", "1"): 0, EndpointKey("badges", "3"): 2}
+	if got := sweep(members, start); len(got) != 0 {
+		t.Fatalf("orphaned %v on the first empty scan", got)
+	}
+
+	// 2 comes back before the grace period ends, which resets it
+	members[EndpointKey("badges", "2")] = 1
+	if got := sweep(members, start.Add(30*time.Minute)); len(got) != 0 {
+		t.Fatalf("orphaned %v within the grace period", got)
+	}
+	delete(members, EndpointKey("badges", "2"))
+
+	// a scan without queue titles is skipped instead of counting as empty
+	if got := sweep(map[string]int{}, start.Add(2*time.Hour)); len(got) != 0 {
+		t.Fatalf("orphaned %v from an empty scan", got)
+	}
+
+	if got := sweep(members, start.Add(2*time.Hour)); !slices.Equal(got, []string{"1"}) {
+		t.Fatalf("got orphans %v, want [1]", got)
+	}
+	// the other site still tracks 1, so it stays scheduled
+	if state, ok := s.Lookup(EndpointKey("badges", "1")); !ok || len(state.Categories) != 1 {
+		t.Errorf("endpoint 1 should stay tracked by the other wiki: %+v", state)
+	}
+
+	if got := sweep(members, start.Add(3*time.Hour)); !slices.Equal(got, []string{"2"}) {
+		t.Fatalf("got orphans %v, want [2] an hour after it emptied again", got)
+	}
+	if _, ok := s.Lookup(EndpointKey("badges", "2")); ok {
+		t.Error("endpoint 2 is still tracked with no wiki left")
+	}
+	if _, ok := s.Lookup(EndpointKey("badges", "3")); !ok {
+		t.Error("endpoint 3 with members was dropped")
+	}
+}
+
+func TestBootstrapAppliesPolicy(t *testing.T) {
+	t.Chdir(t.TempDir())
+	site := &Site{Name: "a"}
+	if err := os.MkdirAll(site.DataDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"badges-1.json", "badges-13.json", "users-1.json", "users-2.json", "status.json"} {
+		if err := os.WriteFile(filepath.Join(site.DataDir(), name), []byte(`{}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{
+		APIMap: map[string]string{"badges": "https://badges.roblox.com/v1/badges/%s", "users": "https://apis.roblox.com/cloud/v2/users/%s"},
+		Policy: config.PolicyConfig{
+			Deny:   map[string][]string{"badges": {"13"}},
+			Quotas: map[string]int{"users": 1},
+		},
+	}}
+	s := NewScheduler(cfg)
+	s.Bootstrap([]*Site{site}, NewPolicy(cfg))
+
+	keys := s.Keys()
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"badges-1", "users-1"}) {
+		t.Errorf("bootstrap tracked %v, want [badges-1 users-1]", keys)
+	}
+}
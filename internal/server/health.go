@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A watched loop is stalled once it has not beaten for stallFactor intervals,
+// and never sooner than minStallAge.
+const (
+	stallFactor = 3
+	minStallAge = 5 * time.Minute
+)
+
+// Health backs the /healthz and /readyz probes. Readiness waits until every
+// required check has passed once; liveness fails when a watched loop stops
+// beating.
+type Health struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	loops   map[string]*loop
+}
+
+type loop struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func NewHealth() *Health {
+	return &Health{
+		pending: make(map[string]bool),
+		loops:   make(map[string]*loop),
+	}
+}
+
+// Require adds checks that must pass before the daemon is ready.
+func (h *Health) Require(checks ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, check := range checks {
+		h.pending[check] = true
+	}
+}
+
+func (h *Health) Pass(check string) {
+	h.mu.Lock()
+	delete(h.pending, check)
+	h.mu.Unlock()
+}
+
+// Watch starts tracking a loop expected to Beat every interval.
+func (h *Health) Watch(name string, interval time.Duration) {
+	h.mu.Lock()
+	h.loops[name] = &loop{interval: interval, last: time.Now()}
+	h.mu.Unlock()
+}
+
+func (h *Health) Beat(name string) {
+	h.mu.Lock()
+	if l, ok := h.loops[name]; ok {
+		l.last = time.Now()
+	}
+	h.mu.Unlock()
+}
+
+// Stop forgets a loop that exited on purpose.
+func (h *Health) Stop(name string) {
+	h.mu.Lock()
+	delete(h.loops, name)
+	h.mu.Unlock()
+}
+
+func (h *Health) stalled(now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var stalled []string
+	for name, l := range h.loops {
+		if now.Sub(l.last) > max(stallFactor*l.interval, minStallAge) {
+			stalled = append(stalled, name)
+		}
+	}
+	slices.Sort(stalled)
+	return stalled
+}
+
+func (h *Health) unready() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var pending []string
+	for check := range h.pending {
+		pending = append(pending, check)
+	}
+	slices.Sort(pending)
+	return pending
+}
+
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, "stalled", h.stalled(time.Now()))
+	})
+}
+
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, "pending", h.unready())
+	})
+}
+
+func writeProbe(w http.ResponseWriter, field string, failing []string) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(failing) == 0 {
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]any{"status": "unavailable", field: failing})
+}
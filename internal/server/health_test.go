@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, handler http.Handler) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid probe body %q: %v", rec.Body, err)
+	}
+	return rec.Code, body
+}
+
+func TestReadiness(t *testing.T) {
+	h := NewHealth()
+	h.Require("login a", "module a")
+
+	code, body := probe(t, h.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Fatalf("got %d %v before any check passed", code, body)
+	}
+	if pending := body["pending"].([]any); len(pending) != 2 || pending[0] != "login a" || pending[1] != "module a" {
+		t.Errorf("got pending %v", pending)
+	}
+
+	h.Pass("login a")
+	h.Pass("login a")
+	if _, body := probe(t, h.ReadinessHandler()); len(body["pending"].([]any)) != 1 {
+		t.Errorf("got pending %v after one check passed", body["pending"])
+	}
+
+	h.Pass("module a")
+	if code, body := probe(t, h.ReadinessHandler()); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("got %d %v once every check passed", code, body)
+	}
+}
+
+func TestStalled(t *testing.T) {
+	start := time.Now()
+	h := NewHealth()
+	h.Watch("scheduler", time.Minute)
+	h.Watch("category scan", time.Hour)
+	h.Watch("gone", time.Minute)
+	h.Stop("gone")
+
+	tests := []struct {
+		after time.Duration
+		want  []string
+	}{
+		{after: 4 * time.Minute},
+		// past 3 scheduler intervals, but not past the 5 minute floor
+		{after: 5 * time.Minute},
+		{after: 6 * time.Minute, want: []string{"scheduler"}},
+		{after: 3*time.Hour + time.Minute, want: []string{"category scan", "scheduler"}},
+	}
+	for _, tt := range tests {
+		if got := h.stalled(start.Add(tt.after)); !slices.Equal(got, tt.want) {
+			t.Errorf("after %v: got stalled %v, want %v", tt.after, got, tt.want)
+		}
+	}
+
+	h.Beat("scheduler")
+	if got := h.stalled(time.Now().Add(4 * time.Minute)); len(got) != 0 {
+		t.Errorf("got stalled %v right after a beat", got)
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	h := NewHealth()
+	h.Watch("scheduler", time.Minute)
+	if code, body := probe(t, h.LivenessHandler()); code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("got %d %v for a fresh loop", code, body)
+	}
+
+	h.mu.Lock()
+	h.loops["scheduler"].last = time.Now().Add(-time.Hour)
+	h.mu.Unlock()
+	code, body := probe(t, h.LivenessHandler())
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d for a stalled loop", code)
+	}
+	if stalled := body["stalled"].([]any); len(stalled) != 1 || stalled[0] != "scheduler" {
+		t.Errorf("got stalled %v", stalled)
+	}
+}
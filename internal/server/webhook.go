@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxWebhookBody         = 64 << 10
+	webhookSignatureMaxAge = 10 * time.Minute
+)
+
+type RefreshRequest struct {
+	UniverseID string
+	PlaceID    string
+}
+
+// webhookPayload accepts both a plain {"universeId", "placeId"} body (e.g. from
+// HttpService in a game server) and Roblox webhook notifications, which carry
+// the IDs in EventPayload.
+type webhookPayload struct {
+	UniverseID   json.Number `json:"universeId"`
+	PlaceID      json.Number `json:"placeId"`
+	EventPayload struct {
+		UniverseID json.Number `json:"UniverseId"`
+		PlaceID    json.Number `json:"PlaceId"`
+	} `json:"EventPayload"`
+}
+
+type WebhookHandler struct {
+	secret  string
+	refresh func(RefreshRequest) int
+}
+
+func NewWebhookHandler(secret string, refresh func(RefreshRequest) int) *WebhookHandler {
+	return &WebhookHandler{secret: secret, refresh: refresh}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookBody {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := h.verify(r, body, time.Now()); err != nil {
+		slog.Warn("rejected webhook", "remote_addr", r.RemoteAddr, "err", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req := RefreshRequest{
+		UniverseID: firstNonEmpty(payload.UniverseID, payload.EventPayload.UniverseID),
+		PlaceID:    firstNonEmpty(payload.PlaceID, payload.EventPayload.PlaceID),
+	}
+	if req.UniverseID == "" && req.PlaceID == "" {
+		http.Error(w, "universeId or placeId required", http.StatusBadRequest)
+		return
+	}
+
+	queued := h.refresh(req)
+	slog.Info("webhook queued endpoints", "count", queued, "universe_id", req.UniverseID, "place_id", req.PlaceID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, `{"queued":%d}`, queued)
+}
+
+// verify accepts either a Roblox style "roblox-signature: t=<unix>,v1=<base64
+// hmac-sha256 of t.body>" header or the shared secret as a bearer token.
+func (h *WebhookHandler) verify(r *http.Request, body []byte, now time.Time) error {
+	if signature := r.Header.Get("roblox-signature"); signature != "" {
+		return h.verifyRobloxSignature(signature, body, now)
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		return fmt.Errorf("missing or wrong shared secret")
+	}
+	return nil
+}
+
+func (h *WebhookHandler) verifyRobloxSignature(header string, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > webhookSignatureMaxAge || age < -webhookSignatureMaxAge {
+		return fmt.Errorf("signature timestamp outside allowed window (%v)", age)
+	}
+
+	mac := hmac.New(sha256.New, []byte(h.secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+func firstNonEmpty(values ...json.Number) string {
+	for _, v := range values {
+		if v != "" {
+			return v.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+func sign(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandler(t *testing.T) {
+	const body = `{"universeId": 1176784616}`
+	now := time.Now().Unix()
+	valid := fmt.Sprintf("t=%d,v1=%s", now, sign(testSecret, now, body))
+
+	tests := []struct {
+		name    string
+		body    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "valid signature", body: body, headers: map[string]string{"roblox-signature": valid}, want: http.StatusAccepted},
+		{name: "second v1 matches", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d, v1=bm9wZQ==, v1=%s", now, sign(testSecret, now, body))}, want: http.StatusAccepted},
+		{name: "tampered body", body: `{"universeId": 1}`, headers: map[string]string{"roblox-signature": valid}, want: http.StatusUnauthorized},
+		{name: "wrong secret", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d,v1=%s", now, sign("other", now, body))}, want: http.StatusUnauthorized},
+		{name: "expired timestamp", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d,v1=%s", now-11*60, sign(testSecret, now-11*60, body))}, want: http.StatusUnauthorized},
+		{name: "future timestamp", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d,v1=%s", now+11*60, sign(testSecret, now+11*60, body))}, want: http.StatusUnauthorized},
+		{name: "timestamp swapped after signing", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d,v1=%s", now-1, sign(testSecret, now, body))}, want: http.StatusUnauthorized},
+		{name: "missing timestamp", body: body, headers: map[string]string{"roblox-signature": "v1=" + sign(testSecret, now, body)}, want: http.StatusUnauthorized},
+		{name: "missing v1", body: body, headers: map[string]string{"roblox-signature": fmt.Sprintf("t=%d", now)}, want: http.StatusUnauthorized},
+		{name: "no credentials", body: body, want: http.StatusUnauthorized},
+		{name: "bearer secret", body: body, headers: map[string]string{"Authorization": "Bearer " + testSecret}, want: http.StatusAccepted},
+		{name: "wrong bearer secret", body: body, headers: map[string]string{"Authorization": "Bearer nope"}, want: http.StatusUnauthorized},
+		{name: "bad signature beats a good bearer", body: body, headers: map[string]string{"roblox-signature": "t=1,v1=x", "Authorization": "Bearer " + testSecret}, want: http.StatusUnauthorized},
+		{name: "roblox notification payload", body: `{"EventPayload": {"UniverseId": 1, "PlaceId": 2}}`, headers: map[string]string{"Authorization": "Bearer " + testSecret}, want: http.StatusAccepted},
+		{name: "no ids", body: `{}`, headers: map[string]string{"Authorization": "Bearer " + testSecret}, want: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, headers: map[string]string{"Authorization": "Bearer " + testSecret}, want: http.StatusBadRequest},
+		{name: "body too large", body: `{"universeId": 1, "pad": "` + strings.Repeat("x", maxWebhookBody) + `"}`, headers: map[string]string{"Authorization": "Bearer " + testSecret}, want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []RefreshRequest
+			h := NewWebhookHandler(testSecret, func(req RefreshRequest) int {
+				got = append(got, req)
+				return 3
+			})
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusAccepted {
+				if len(got) != 0 {
+					t.Errorf("refresh called for a rejected request: %+v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].UniverseID == "" {
+				t.Errorf("got refresh requests %+v", got)
+			}
+			if rec.Body.String() != `{"queued":3}` {
+				t.Errorf("got body %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"robloxapid/internal/config"
+	"robloxapid/internal/wiki"
+)
+
+// Site is one wiki served by the daemon. Named sites keep their local copies
+// under data/<name>/ so change detection is tracked per wiki.
+type Site struct {
+	Name   string
+	Client *wiki.WikiClient
+	Config config.WikiConfig
+}
+
+// Target is a site tracking an endpoint through one of its queue categories.
+type Target struct {
+	Site     *Site
+	Category string
+}
+
+func (s *Site) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Config.APIURL
+}
+
+func (s *Site) DataDir() string {
+	return filepath.Join("data", s.Name)
+}
+
+func (s *Site) dataPath(filename string) string {
+	return filepath.Join(s.Name, filename)
+}
+
+func (s *Site) pageTitle(slug string) string {
+	return fmt.Sprintf("%s:roapid/%s", s.Config.Namespace, slug)
+}
+
+func (s *Site) Category(endpointType, id string) string {
+	return fmt.Sprintf("Category:%s-%s-%s", s.Config.CategoryPrefix, endpointType, id)
+}
+
+// QueueTitle is the page whose users track the endpoint: its queue category,
+// or its data page when endpoints are discovered through embedding pages.
+func (s *Site) QueueTitle(endpointType, id string) string {
+	if s.Config.Discovery == config.DiscoveryEmbeddedIn {
+		return s.pageTitle(fmt.Sprintf("%s-%s.json", endpointType, id))
+	}
+	return s.Category(endpointType, id)
+}
+
+func (s *Site) ModuleTitle() string {
+	return s.Config.Namespace + ":Roapid"
+}
+
+// QueueTitles lists the site's queue titles, each with the number of pages
+// using it.
+func (s *Site) QueueTitles(ctx context.Context) ([]wiki.Category, error) {
+	if s.Config.Discovery == config.DiscoveryEmbeddedIn {
+		return s.Client.GetEmbeddedTemplates(ctx, s.ModuleTitle(), s.pageTitle(""))
+	}
+	return s.Client.GetCategoriesWithPrefix(ctx, s.Config.CategoryPrefix)
+}
+
+// ChangedQueueTitles is QueueTitles for the given pages only.
+func (s *Site) ChangedQueueTitles(ctx context.Context, titles []string) ([]wiki.Category, error) {
+	if s.Config.Discovery == config.DiscoveryEmbeddedIn {
+		return s.Client.GetPagesTemplates(ctx, titles, s.pageTitle(""))
+	}
+	return s.Client.GetPagesCategoriesWithPrefix(ctx, titles, s.Config.CategoryPrefix)
+}
+
+func (s *Site) ParseQueueTitle(title string, apiMap map[string]string) (endpointType, id string, err error) {
+	if s.Config.Discovery == config.DiscoveryEmbeddedIn {
+		return ParseDataTitle(title, s.Config.Namespace, apiMap)
+	}
+	return ParseCategory(title, s.Config.CategoryPrefix, apiMap)
+}
+
+// purgeUsers purges the pages using an endpoint, given its queue title.
+func (s *Site) purgeUsers(ctx context.Context, queueTitle string) error {
+	if s.Config.Discovery == config.DiscoveryEmbeddedIn {
+		return s.Client.PurgeEmbeddingPages(ctx, queueTitle)
+	}
+	return s.Client.PurgeCategoryMembers(ctx, queueTitle)
+}
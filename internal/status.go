@@ -0,0 +1,165 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"robloxapid/internal/storage"
+)
+
+const statusFilename = "status.json"
+
+// Status is published to the site's roapid/status.json page.
+type Status struct {
+	Endpoints []EndpointStatus `json:"endpoints"`
+	Rejected  []Rejection      `json:"rejected"`
+}
+
+type EndpointStatus struct {
+	EndpointType string `json:"endpointType"`
+	ID           string `json:"id"`
+	Category     string `json:"category"`
+	LastSuccess  string `json:"lastSuccess,omitempty"`
+	LastError    string `json:"lastError,omitempty"`
+	LastErrorAt  string `json:"lastErrorAt,omitempty"`
+	NextRun      string `json:"nextRun,omitempty"`
+}
+
+// BuildStatus gathers the endpoints site tracks and the categories it rejected.
+func BuildStatus(scheduler *Scheduler, policy *Policy, site *Site) Status {
+	status := Status{Endpoints: []EndpointStatus{}, Rejected: policy.Rejections(site)}
+	for _, state := range scheduler.SiteEndpoints(site) {
+		status.Endpoints = append(status.Endpoints, EndpointStatus{
+			EndpointType: state.EndpointType,
+			ID:           state.ID,
+			Category:     state.Categories[site],
+			LastSuccess:  formatStatusTime(state.LastSuccess),
+			LastError:    state.LastError,
+			LastErrorAt:  formatStatusTime(state.LastErrorAt),
+			NextRun:      formatStatusTime(state.NextRun),
+		})
+	}
+	if status.Rejected == nil {
+		status.Rejected = []Rejection{}
+	}
+	return status
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// stable returns the status without the times that move on every refresh, so
+// comparing it tells whether anything worth an edit changed: endpoints coming
+// and going, first successes, errors and rejections.
+func (s Status) stable() Status {
+	stable := Status{Endpoints: make([]EndpointStatus, len(s.Endpoints)), Rejected: s.Rejected}
+	for i, endpoint := range s.Endpoints {
+		if endpoint.LastSuccess != "" {
+			endpoint.LastSuccess = "ok"
+		}
+		endpoint.LastErrorAt = ""
+		endpoint.NextRun = ""
+		stable.Endpoints[i] = endpoint
+	}
+	return stable
+}
+
+// statusChanged compares status with the one saved at dataPath, ignoring the
+// times stable leaves out.
+func statusChanged(dataPath string, status Status) (bool, error) {
+	saved, err := storage.Load(dataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var previous Status
+	if err := json.Unmarshal(saved, &previous); err != nil {
+		return true, nil
+	}
+	oldContent, err := json.Marshal(previous.stable())
+	if err != nil {
+		return false, err
+	}
+	newContent, err := json.Marshal(status.stable())
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(oldContent, newContent), nil
+}
+
+// PublishStatus pushes the site's status page when it changed, along with the
+// wikitext report page when one is configured. The refresh times in it are
+// only brought up to date by those edits.
+func PublishStatus(ctx context.Context, site *Site, status Status, reportPage string) error {
+	content, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	dataPath := site.dataPath(statusFilename)
+	hasChanged, err := statusChanged(dataPath, status)
+	if err != nil {
+		return fmt.Errorf("error checking changes for %s: %w", statusFilename, err)
+	}
+	if !hasChanged {
+		slog.Debug("unchanged, skipping wiki update", "wiki", site.String(), "file", statusFilename)
+		return nil
+	}
+
+	dataToPush, err := storage.Save(dataPath, content)
+	if err != nil {
+		return fmt.Errorf("error saving status data: %w", err)
+	}
+
+	wikiTitle := site.pageTitle(statusFilename)
+	if err := site.Client.Push(ctx, wikiTitle, string(dataToPush), "Automated status update"); err != nil {
+		return fmt.Errorf("error pushing status page to wiki: %w", err)
+	}
+
+	if reportPage != "" {
+		if err := site.Client.Push(ctx, reportPage, renderStatusReport(status), "Automated status report"); err != nil {
+			return fmt.Errorf("error pushing status report to wiki: %w", err)
+		}
+	}
+
+	slog.Info("successfully updated status page", "wiki", site.String(), "wiki_title", wikiTitle)
+	return nil
+}
+
+func renderStatusReport(status Status) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This page is updated automatically by RobloxAPID, edits will be overwritten. Last updated %s.\n\n", time.Now().UTC().Format(time.RFC3339))
+
+	b.WriteString("== Tracked endpoints ==\n")
+	b.WriteString("{| class=\"wikitable sortable\"\n! Type !! ID !! Last success !! Next run !! Last error\n")
+	for _, endpoint := range status.Endpoints {
+		lastError := ""
+		if endpoint.LastError != "" {
+			lastError = fmt.Sprintf("%s: <nowiki>%s</nowiki>", endpoint.LastErrorAt, html.EscapeString(endpoint.LastError))
+		}
+		fmt.Fprintf(&b, "|-\n| %s || <nowiki>%s</nowiki> || %s || %s || %s\n", endpoint.EndpointType, html.EscapeString(endpoint.ID), endpoint.LastSuccess, endpoint.NextRun, lastError)
+	}
+	b.WriteString("|}\n\n")
+
+	b.WriteString("== Rejected categories ==\n")
+	b.WriteString("{| class=\"wikitable sortable\"\n! Category !! Reason !! Since\n")
+	for _, rejection := range status.Rejected {
+		fmt.Fprintf(&b, "|-\n| [[:%s]] || <nowiki>%s</nowiki> || %s\n", rejection.Category, html.EscapeString(rejection.Reason), formatStatusTime(rejection.Since))
+	}
+	b.WriteString("|}\n")
+	return b.String()
+}
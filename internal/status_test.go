@@ -0,0 +1,69 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"robloxapid/internal/storage"
+)
+
+func TestStatusChanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+	const path = "a/status.json"
+	saved := Status{
+		Endpoints: []EndpointStatus{{EndpointType: "badges", ID: "1", Category: "Category:roapid-badges-1", LastSuccess: "2026-01-01T00:00:00Z", NextRun: "2026-01-01T01:00:00Z"}},
+		Rejected:  []Rejection{},
+	}
+
+	if changed, err := statusChanged(path, saved); err != nil || !changed {
+		t.Fatalf("missing status page: got %v, %v, want changed", changed, err)
+	}
+	content, _ := json.Marshal(saved)
+	if _, err := storage.Save(path, content); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(*EndpointStatus)
+		change bool
+	}{
+		{name: "new refresh times", edit: func(e *EndpointStatus) {
+			e.LastSuccess = "2026-01-01T01:00:00Z"
+			e.NextRun = "2026-01-01T02:03:00Z"
+		}},
+		{name: "new error", change: true, edit: func(e *EndpointStatus) {
+			e.LastError = "boom"
+			e.LastErrorAt = "2026-01-01T01:00:00Z"
+		}},
+		{name: "never succeeded", change: true, edit: func(e *EndpointStatus) { e.LastSuccess = "" }},
+		{name: "new category", change: true, edit: func(e *EndpointStatus) { e.Category = "Category:roapid-badges-01" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := Status{Endpoints: []EndpointStatus{saved.Endpoints[0]}, Rejected: []Rejection{}}
+			tt.edit(&status.Endpoints[0])
+			changed, err := statusChanged(path, status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.change {
+				t.Errorf("got changed %v, want %v", changed, tt.change)
+			}
+		})
+	}
+}
+
+func TestRenderStatusReportEscapes(t *testing.T) {
+	report := renderStatusReport(Status{
+		Endpoints: []EndpointStatus{{EndpointType: "users", ID: "@a</nowiki>[[b]]", LastError: "bad </nowiki>{{x}}", LastErrorAt: "t"}},
+		Rejected:  []Rejection{{Category: "Category:roapid-users-x", Reason: "</nowiki><script>"}},
+	})
+	if strings.Count(report, "</nowiki>") != 3 {
+		t.Errorf("an error, ID or reason closed its nowiki early:\n%s", report)
+	}
+	if !strings.Contains(report, "bad &lt;/nowiki&gt;{{x}}") {
+		t.Errorf("error text not escaped:\n%s", report)
+	}
+}
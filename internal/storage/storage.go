@@ -73,3 +73,31 @@ func Save(path string, data []byte) ([]byte, error) {
 
 	return dataToSave, nil
 }
+
+// Remove deletes a local data file, if it exists.
+func Remove(path string) error {
+	dataRoot, err := os.OpenRoot("data")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer dataRoot.Close()
+
+	if err := dataRoot.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Load reads a local data file.
+func Load(path string) ([]byte, error) {
+	dataRoot, err := os.OpenRoot("data")
+	if err != nil {
+		return nil, err
+	}
+	defer dataRoot.Close()
+
+	return dataRoot.ReadFile(path)
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"robloxapid/internal/config"
+	"robloxapid/internal/fetcher"
+)
+
+const (
+	thumbnailBatchSize = 100
+	thumbnailCacheTTL  = 5 * time.Minute
+)
+
+// thumbnailKinds maps the kind in "thumbnails-<kind>-<id>" to the batch path
+// on thumbnails.roblox.com, %s being a comma separated list of target IDs.
+var thumbnailKinds = map[string]string{
+	"assets":    "assets?assetIds=%s&size=420x420&format=Png",
+	"badges":    "badges/icons?badgeIds=%s&size=150x150&format=Png",
+	"users":     "users/avatar-headshot?userIds=%s&size=420x420&format=Png",
+	"avatars":   "users/avatar?userIds=%s&size=420x420&format=Png",
+	"universes": "games/icons?universeIds=%s&size=512x512&format=Png",
+	"groups":    "groups/icons?groupIds=%s&size=420x420&format=Png",
+}
+
+type thumbnailResponse struct {
+	Data []json.RawMessage `json:"data"`
+}
+
+type thumbnailEntry struct {
+	TargetID json.Number `json:"targetId"`
+	State    string      `json:"state"`
+}
+
+type cachedThumbnail struct {
+	data    []byte
+	fetched time.Time
+}
+
+var thumbnailCache = struct {
+	sync.Mutex
+	entries map[string]cachedThumbnail
+}{entries: make(map[string]cachedThumbnail)}
+
+func splitThumbnailID(id string) (kind, targetID string, err error) {
+	kind, targetID, ok := strings.Cut(id, "-")
+	kind = strings.ToLower(kind)
+	if !ok || targetID == "" {
+		return "", "", fmt.Errorf("invalid thumbnail identifier %q, expected kind-id", id)
+	}
+	if _, known := thumbnailKinds[kind]; !known {
+		return "", "", fmt.Errorf("unknown thumbnail kind %q", kind)
+	}
+	return kind, targetID, nil
+}
+
+func thumbnailURL(template, kind string, targetIDs []string) string {
+	return fmt.Sprintf(template, fmt.Sprintf(thumbnailKinds[kind], strings.Join(targetIDs, ",")))
+}
+
+// PrefetchThumbnails resolves the given thumbnail IDs in as few requests as
+// possible so the following ProcessEndpoint calls are served from memory.
+func PrefetchThumbnails(ctx context.Context, cfg *config.Config, ids []string) {
+	template, ok := cfg.DynamicEndpoints.APIMap["thumbnails"]
+	if !ok || len(ids) < 2 {
+		return
+	}
+
+	// batches only share credentials when they route to the same profile
+	type batchKey struct{ kind, profile string }
+	bases := make(map[batchKey]fetcher.Request)
+	batches := make(map[batchKey][]string)
+	for _, id := range ids {
+		kind, targetID, err := splitThumbnailID(id)
+		if err != nil {
+			continue
+		}
+		base := robloxCookieRequest(cfg, "thumbnails", id)
+		key := batchKey{kind: kind, profile: base.Profile}
+		bases[key] = base
+		batches[key] = append(batches[key], targetID)
+	}
+
+	for key, targetIDs := range batches {
+		kind, base := key.kind, bases[key]
+		for start := 0; start < len(targetIDs); start += thumbnailBatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			batch := targetIDs[start:min(start+thumbnailBatchSize, len(targetIDs))]
+			req := base
+			req.URL = thumbnailURL(template, kind, batch)
+			entries, err := fetchThumbnailBatch(ctx, req)
+			if err != nil {
+				slog.Error("error prefetching thumbnails", "count", len(batch), "kind", kind, "url", req.URL, "err", err)
+				continue
+			}
+
+			now := time.Now()
+			thumbnailCache.Lock()
+			for targetID, data := range entries {
+				thumbnailCache.entries[kind+"-"+targetID] = cachedThumbnail{data: data, fetched: now}
+			}
+			thumbnailCache.Unlock()
+			slog.Debug("prefetched thumbnails in one request", "count", len(entries), "kind", kind)
+		}
+	}
+}
+
+func fetchThumbnail(ctx context.Context, req fetcher.Request, id string) ([]byte, error) {
+	kind, targetID, err := splitThumbnailID(id)
+	if err != nil {
+		return nil, err
+	}
+	key := kind + "-" + targetID
+
+	thumbnailCache.Lock()
+	cached, ok := thumbnailCache.entries[key]
+	delete(thumbnailCache.entries, key)
+	for k, entry := range thumbnailCache.entries {
+		if time.Since(entry.fetched) > thumbnailCacheTTL {
+			delete(thumbnailCache.entries, k)
+		}
+	}
+	thumbnailCache.Unlock()
+
+	if ok && time.Since(cached.fetched) <= thumbnailCacheTTL {
+		return checkThumbnailState(id, cached.data)
+	}
+
+	entries, err := fetchThumbnailBatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := entries[targetID]
+	if !ok {
+		return nil, fmt.Errorf("thumbnail %s missing from response", id)
+	}
+	return checkThumbnailState(id, data)
+}
+
+func checkThumbnailState(id string, data []byte) ([]byte, error) {
+	var entry thumbnailEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.State == "Pending" {
+		return nil, fmt.Errorf("thumbnail %s is still pending", id)
+	}
+	return data, nil
+}
+
+func fetchThumbnailBatch(ctx context.Context, req fetcher.Request) (map[string][]byte, error) {
+	body, err := fetcher.FetchPages(ctx, req, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var res thumbnailResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse thumbnails response: %w", err)
+	}
+
+	entries := make(map[string][]byte, len(res.Data))
+	for _, raw := range res.Data {
+		var entry thumbnailEntry
+		if err := json.Unmarshal(raw, &entry); err != nil || entry.TargetID == "" {
+			continue
+		}
+		entries[entry.TargetID.String()] = raw
+	}
+	return entries, nil
+}
+
+// robloxCookieRequest returns a request carrying the cookie of the credential
+// profile routed to the endpoint, if it has one.
+func robloxCookieRequest(cfg *config.Config, endpointType, id string) fetcher.Request {
+	profileName, creds := cfg.CredentialsFor(endpointType, credentialRoutingID(cfg, endpointType, id))
+	req := fetcher.Request{Profile: profileName, EndpointType: endpointType}
+	if creds.Cookie != "" {
+		req.Headers = map[string]string{"Cookie": creds.Cookie}
+	}
+	return req
+}
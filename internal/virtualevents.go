@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"robloxapid/internal/config"
+)
+
+const (
+	eventWindowUpcoming = "upcoming"
+	eventWindowActive   = "active"
+	eventWindowPast     = "past"
+)
+
+type virtualEvent struct {
+	EventTime struct {
+		StartUTC time.Time `json:"startUtc"`
+		EndUTC   time.Time `json:"endUtc"`
+	} `json:"eventTime"`
+}
+
+// splitVirtualEventsID separates "<universeId>" or "<universeId>-<window>".
+func splitVirtualEventsID(id string) (universeID, window string, err error) {
+	universeID, window, _ = strings.Cut(id, "-")
+	if universeID == "" {
+		return "", "", fmt.Errorf("invalid virtual-events identifier %q, expected universeId or universeId-window", id)
+	}
+	switch strings.ToLower(window) {
+	case "", eventWindowUpcoming, eventWindowActive, eventWindowPast:
+		return universeID, strings.ToLower(window), nil
+	}
+	return "", "", fmt.Errorf("unknown virtual-events window %q, expected %s, %s or %s", window, eventWindowUpcoming, eventWindowActive, eventWindowPast)
+}
+
+func virtualEventsURL(rawURL, window string, now time.Time, cfg *config.Config) (string, error) {
+	parsedURL, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid virtual-events url %s: %w", rawURL, err)
+	}
+
+	query := parsedURL.Query()
+	switch window {
+	case eventWindowUpcoming, eventWindowActive:
+		query.Set("endsAfter", now.Format(iso8601Millis))
+	case eventWindowPast:
+		query.Set("endsAfter", now.Add(-cfg.GetVirtualEventsPastWindow()).Format(iso8601Millis))
+		query.Set("endsBefore", now.Format(iso8601Millis))
+	default:
+		query.Set("endsBefore", now.Format(iso8601Millis))
+	}
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), nil
+}
+
+// filterVirtualEvents enforces the window locally, since the API only filters
+// on end time, and orders the events so data[1] is the most relevant one.
+func filterVirtualEvents(data []byte, window string, now time.Time, cfg *config.Config) ([]byte, error) {
+	if window == "" {
+		return data, nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var events []json.RawMessage
+	if raw, ok := doc["data"]; ok {
+		if err := json.Unmarshal(raw, &events); err != nil {
+			return nil, fmt.Errorf("unexpected virtual-events data: %w", err)
+		}
+	}
+
+	pastStart := now.Add(-cfg.GetVirtualEventsPastWindow())
+	type entry struct {
+		raw   json.RawMessage
+		event virtualEvent
+	}
+	kept := make([]entry, 0, len(events))
+	for _, raw := range events {
+		var ev virtualEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			continue
+		}
+		start, end := ev.EventTime.StartUTC, ev.EventTime.EndUTC
+
+		var keep bool
+		switch window {
+		case eventWindowUpcoming:
+			keep = start.After(now)
+		case eventWindowActive:
+			keep = !start.After(now) && end.After(now)
+		case eventWindowPast:
+			keep = !end.After(now) && !end.Before(pastStart)
+		}
+		if keep {
+			kept = append(kept, entry{raw, ev})
+		}
+	}
+
+	if window == eventWindowPast {
+		slices.SortStableFunc(kept, func(a, b entry) int {
+			return b.event.EventTime.EndUTC.Compare(a.event.EventTime.EndUTC)
+		})
+	} else {
+		slices.SortStableFunc(kept, func(a, b entry) int {
+			return a.event.EventTime.StartUTC.Compare(b.event.EventTime.StartUTC)
+		})
+	}
+
+	filtered := make([]json.RawMessage, len(kept))
+	for i, e := range kept {
+		filtered[i] = e.raw
+	}
+	encoded, err := json.Marshal(filtered)
+	if err != nil {
+		return nil, err
+	}
+	doc["data"] = encoded
+	return json.Marshal(doc)
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"strings"
+
+	"robloxapid/internal/config"
+)
+
+// universeKeyedEndpoints are the endpoint types whose ID is a universe ID.
+var universeKeyedEndpoints = map[string]bool{
+	"universes":          true,
+	"games":              true,
+	"favorites":          true,
+	"votes":              true,
+	"universe-badges":    true,
+	"game-passes":        true,
+	"developer-products": true,
+}
+
+// EndpointMatchesUniverse reports whether the endpoint holds data about the
+// given universe or place, used to pick what a webhook should refresh.
+func EndpointMatchesUniverse(cfg *config.Config, endpointType, id, universeID, placeID string) bool {
+	switch {
+	case universeKeyedEndpoints[endpointType]:
+		return universeID != "" && id == universeID
+	case endpointType == "places":
+		u, p, _ := strings.Cut(id, "-")
+		return (universeID != "" && u == universeID) || (placeID != "" && p == placeID)
+	case endpointType == "virtual-events":
+		u, _, err := splitVirtualEventsID(id)
+		return err == nil && universeID != "" && u == universeID
+	case endpointType == "thumbnails":
+		return universeID != "" && strings.EqualFold(id, "universes-"+universeID)
+	case endpointType == "ordered-datastores":
+		store, ok := cfg.DynamicEndpoints.DataStores.Ordered[id]
+		return ok && universeID != "" && store.UniverseID == universeID
+	case endpointType == "datastores":
+		entry, ok := cfg.DynamicEndpoints.DataStores.Entries[id]
+		return ok && universeID != "" && entry.UniverseID == universeID
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"testing"
+
+	"robloxapid/internal/config"
+)
+
+func TestEndpointMatchesUniverse(t *testing.T) {
+	cfg := &config.Config{DynamicEndpoints: config.DynamicEndpointsConfig{DataStores: config.DataStoresConfig{
+		Ordered: map[string]config.OrderedDataStoreConfig{"wins": {UniverseID: "10"}},
+		Entries: map[string]config.DataStoreEntryConfig{"motd": {UniverseID: "20"}},
+	}}}
+
+	tests := []struct {
+		endpointType, id    string
+		universeID, placeID string
+		want                bool
+	}{
+		{endpointType: "universes", id: "10", universeID: "10", want: true},
+		{endpointType: "universes", id: "10", placeID: "10"},
+		{endpointType: "badges", id: "10", universeID: "10"},
+		{endpointType: "places", id: "10-99", universeID: "10", want: true},
+		{endpointType: "places", id: "10-99", placeID: "99", want: true},
+		{endpointType: "places", id: "10-99", placeID: "10"},
+		{endpointType: "virtual-events", id: "10-upcoming", universeID: "10", want: true},
+		{endpointType: "virtual-events", id: "10-later", universeID: "10"},
+		{endpointType: "thumbnails", id: "Universes-10", universeID: "10", want: true},
+		{endpointType: "thumbnails", id: "users-10", universeID: "10"},
+		{endpointType: "ordered-datastores", id: "wins", universeID: "10", want: true},
+		{endpointType: "ordered-datastores", id: "wins", universeID: "20"},
+		{endpointType: "datastores", id: "motd", universeID: "20", want: true},
+		{endpointType: "datastores", id: "unlisted", universeID: "20"},
+	}
+	for _, tt := range tests {
+		if got := EndpointMatchesUniverse(cfg, tt.endpointType, tt.id, tt.universeID, tt.placeID); got != tt.want {
+			t.Errorf("%s %s for universe %q place %q: got %v, want %v", tt.endpointType, tt.id, tt.universeID, tt.placeID, got, tt.want)
+		}
+	}
+}
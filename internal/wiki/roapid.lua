@@ -1,7 +1,10 @@
--- 0.0.18
+-- 0.0.27
 -- https://github.com/paradoxum-wikis/RobloxAPID
 local roapid = {}
 
+-- queue categories are only needed when the daemon discovers endpoints through them
+local useQueueCategories = "{{DISCOVERY}}" ~= "embeddedin"
+
 local function getByPath(tbl, parts)
 	local cur = tbl
 	for i = 1, #parts do
@@ -29,7 +32,7 @@ local function buildTitle(resource, id)
 end
 
 local function getQueueCategory(resource, id)
-	if id and id ~= "" then
+	if useQueueCategories and id and id ~= "" then
 		return string.format("[[Category:{{CATEGORY_PREFIX}}-%s-%s]]", resource, id)
 	end
 	return ""
@@ -93,6 +96,9 @@ function roapid._get(frame, resource, needsId)
 
 	local moduleName = buildTitle(resource, id)
 	local ok, data = pcall(mw.loadJsonData, moduleName)
+	if ok and type(data) == "table" and data.roAliasOf then
+		ok, data = pcall(mw.loadJsonData, buildTitle(resource, tostring(data.roAliasOf)))
+	end
 	if not ok or type(data) ~= "table" then
 		return getQueueNotice(resource, id)
 	end
@@ -124,6 +130,18 @@ roapid.games = makeGetter("games", true)
 roapid.favorites = makeGetter("favorites", true)
 roapid.votes = makeGetter("votes", true)
 roapid["virtual-events"] = makeGetter("virtual-events", true)
+roapid.thumbnails = makeGetter("thumbnails", true)
+roapid["universe-badges"] = makeGetter("universe-badges", true)
+roapid["game-passes"] = makeGetter("game-passes", true)
+roapid["game-pass"] = makeGetter("game-pass", true)
+roapid["developer-products"] = makeGetter("developer-products", true)
+roapid["group-roles"] = makeGetter("group-roles", true)
+roapid["group-games"] = makeGetter("group-games", true)
+roapid["group-shout"] = makeGetter("group-shout", true)
+roapid.catalog = makeGetter("catalog", true)
+roapid["ordered-datastores"] = makeGetter("ordered-datastores", true)
+roapid.datastores = makeGetter("datastores", true)
 roapid.about = makeGetter("about", false)
+roapid.status = makeGetter("status", false)
 
 return roapid
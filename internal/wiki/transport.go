@@ -0,0 +1,42 @@
+package wiki
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// abortTransport cancels every request once ctx ends. go-mwclient takes no
+// context per call, so this is how in-flight wiki requests get aborted.
+type abortTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (t *abortTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -1,11 +1,15 @@
 package wiki
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"net/http"
+	neturl "net/url"
 	"slices"
 	"strings"
 	"sync"
@@ -13,10 +17,14 @@ import (
 
 	"cgt.name/pkg/go-mwclient"
 	"cgt.name/pkg/go-mwclient/params"
+
+	"robloxapid/internal/metrics"
 )
 
 type WikiClient struct {
 	client    *mwclient.Client
+	host      string
+	logger    *slog.Logger
 	editMu    sync.Mutex
 	lastEdit  time.Time
 	tokenMu   sync.Mutex
@@ -62,8 +70,57 @@ type mwAllCategoriesResponse struct {
 		AllCategories []struct {
 			Category string `json:"category"`
 			Star     string `json:"*"`
+			Size     int    `json:"size"`
 		} `json:"allcategories"`
 	} `json:"query"`
+	Continue map[string]string `json:"continue"`
+}
+
+// Category is a category title with its number of members.
+type Category struct {
+	Title   string
+	Members int
+}
+
+type mwPageLink struct {
+	Title string `json:"title"`
+}
+
+type mwPageLinksResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Pages []struct {
+			PageID     int64        `json:"pageid"`
+			Templates  []mwPageLink `json:"templates"`
+			Categories []mwPageLink `json:"categories"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+type mwRecentChangesResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		RecentChanges []struct {
+			RCID      int64  `json:"rcid"`
+			Title     string `json:"title"`
+			Timestamp string `json:"timestamp"`
+		} `json:"recentchanges"`
+	} `json:"query"`
+}
+
+// RCCursor marks the last recent change seen.
+type RCCursor struct {
+	ID        int64
+	Timestamp string
+}
+
+type mwEmbeddedInResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		EmbeddedIn []struct {
+			Title string `json:"title"`
+		} `json:"embeddedin"`
+	} `json:"query"`
 }
 
 type mwCategoryMembersResponse struct {
@@ -74,11 +131,17 @@ type mwCategoryMembersResponse struct {
 	} `json:"query"`
 }
 
-func NewWikiClient(apiURL, username, password string, debug bool) (*WikiClient, error) {
+// NewWikiClient logs in to the wiki. Every request the client makes is aborted
+// once ctx ends.
+func NewWikiClient(ctx context.Context, apiURL, username, password string, debug bool) (*WikiClient, error) {
 	client, err := mwclient.New(apiURL, "RobloxAPID/1.0 (https://github.com/paradoxum-wikis/RobloxAPID; User:DarkGabonnie)")
 	if err != nil {
 		return nil, err
 	}
+	client.SetHTTPClient(&http.Client{
+		Transport: &abortTransport{base: http.DefaultTransport, ctx: ctx},
+		Timeout:   30 * time.Second,
+	})
 
 	if err := client.Login(username, password); err != nil {
 		return nil, err
@@ -110,20 +173,27 @@ func NewWikiClient(apiURL, username, password string, debug bool) (*WikiClient,
 
 	w := &WikiClient{
 		client: client,
+		host:   apiURL,
 		debug:  debug,
 	}
+	if parsed, err := neturl.Parse(apiURL); err == nil && parsed.Host != "" {
+		w.host = parsed.Host
+	}
+	w.logger = slog.With("wiki", w.host)
 	if w.debug {
-		client.SetDebug(log.Writer())
+		client.SetDebug(slog.NewLogLogger(w.logger.Handler(), slog.LevelDebug).Writer())
 	}
 	return w, nil
 }
 
-func (w *WikiClient) Push(title, content, summary string) error {
-	w.throttleEdit()
-	log.Printf("[DEBUG] wiki.Push: preparing to push page %s (summary: %s)", title, summary)
+func (w *WikiClient) Push(ctx context.Context, title, content, summary string) error {
+	if err := w.throttleEdit(ctx); err != nil {
+		return err
+	}
+	w.logger.Debug("preparing to push page", "wiki_title", title, "summary", summary)
 	token, err := w.getCSRFToken(false)
 	if err != nil {
-		log.Printf("[ERROR] wiki.Push: failed to get token for %s: %v", title, err)
+		w.logger.Error("failed to get edit token", "wiki_title", title, "err", err)
 		return err
 	}
 
@@ -138,25 +208,32 @@ func (w *WikiClient) Push(title, content, summary string) error {
 
 	_, err = w.client.Post(p)
 	if err != nil && isBadTokenError(err) {
-		log.Printf("[DEBUG] wiki.Push: refreshing invalid token for %s", title)
+		w.logger.Debug("refreshing invalid edit token", "wiki_title", title)
 		token, tokenErr := w.getCSRFToken(true)
 		if tokenErr != nil {
-			log.Printf("[ERROR] wiki.Push: failed to refresh token for %s: %v", title, tokenErr)
+			w.logger.Error("failed to refresh edit token", "wiki_title", title, "err", tokenErr)
 			return tokenErr
 		}
 		p["token"] = token
 		_, err = w.client.Post(p)
 	}
 	if err != nil {
-		log.Printf("[ERROR] wiki.Push: failed to push %s: %v", title, err)
+		metrics.WikiEdits.Inc(w.host, "failed")
+		w.logger.Error("failed to push page", "wiki_title", title, "err", err)
 		return err
 	}
 
-	log.Printf("[INFO] wiki.Push: successfully pushed %s", title)
+	metrics.WikiEdits.Inc(w.host, "edited")
+	w.logger.Info("successfully pushed page", "wiki_title", title)
 	return nil
 }
 
-func (w *WikiClient) throttleEdit() {
+// Host identifies the wiki by its API host, e.g. in metrics.
+func (w *WikiClient) Host() string {
+	return w.host
+}
+
+func (w *WikiClient) throttleEdit(ctx context.Context) error {
 	w.editMu.Lock()
 	defer w.editMu.Unlock()
 
@@ -164,11 +241,18 @@ func (w *WikiClient) throttleEdit() {
 	if !w.lastEdit.IsZero() {
 		wait := time.Second - now.Sub(w.lastEdit)
 		if wait > 0 {
-			time.Sleep(wait)
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
 			now = time.Now()
 		}
 	}
 	w.lastEdit = now
+	return nil
 }
 
 func (w *WikiClient) logRawJSON(label string, rawBody []byte) {
@@ -178,13 +262,16 @@ func (w *WikiClient) logRawJSON(label string, rawBody []byte) {
 	var m any
 	if err := json.Unmarshal(rawBody, &m); err == nil {
 		prettyJSON, _ := json.MarshalIndent(m, "", "  ")
-		log.Printf("[DEBUG] %s:\n%s", label, string(prettyJSON))
+		w.logger.Debug(label, "response", string(prettyJSON))
 	} else {
-		log.Printf("[DEBUG] %s:\n%s", label, string(rawBody))
+		w.logger.Debug(label, "response", string(rawBody))
 	}
 }
 
-func (w *WikiClient) GetPageByName(pageName string) (string, error) {
+func (w *WikiClient) GetPageByName(ctx context.Context, pageName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	p := params.Values{
 		"action":        "query",
 		"prop":          "revisions",
@@ -199,7 +286,7 @@ func (w *WikiClient) GetPageByName(pageName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	w.logRawJSON("GetPageByName response:", respBody)
+	w.logRawJSON("GetPageByName response", respBody)
 
 	var res mwRevisionsResponse
 	if err := json.Unmarshal(respBody, &res); err != nil {
@@ -222,7 +309,10 @@ func (w *WikiClient) GetPageByName(pageName string) (string, error) {
 	return page.Revisions[0].Slots.Main.Content, nil
 }
 
-func (w *WikiClient) PageExists(title string) (bool, error) {
+func (w *WikiClient) PageExists(ctx context.Context, title string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	p := params.Values{
 		"action":        "query",
 		"prop":          "info",
@@ -254,14 +344,14 @@ func (w *WikiClient) PageExists(title string) (bool, error) {
 	return true, nil
 }
 
-func (w *WikiClient) SetupRoapiModule(pageTitle, requiredVersion, content string) error {
-	log.Printf("Checking wiki page: %s", pageTitle)
+func (w *WikiClient) SetupRoapiModule(ctx context.Context, pageTitle, requiredVersion, content string) error {
+	w.logger.Info("checking module page", "wiki_title", pageTitle)
 
-	existingContent, err := w.GetPageByName(pageTitle)
+	existingContent, err := w.GetPageByName(ctx, pageTitle)
 	if err != nil {
 		if err.Error() == "page not found" {
-			log.Printf("Page %s not found. Creating with version %s.", pageTitle, requiredVersion)
-			return w.Push(pageTitle, content, "Initializing Roapid module, version "+requiredVersion)
+			w.logger.Info("module page not found, creating it", "wiki_title", pageTitle, "version", requiredVersion)
+			return w.Push(ctx, pageTitle, content, "Initializing Roapid module, version "+requiredVersion)
 		}
 		return err
 	}
@@ -269,21 +359,21 @@ func (w *WikiClient) SetupRoapiModule(pageTitle, requiredVersion, content string
 	firstLine := strings.SplitN(existingContent, "\n", 2)[0]
 
 	if !strings.HasPrefix(firstLine, "-- ") {
-		log.Printf("Page %s missing version comment. Overwriting with version %s.", pageTitle, requiredVersion)
-		return w.Push(pageTitle, content, "Updating Roapid module to version "+requiredVersion)
+		w.logger.Info("module page missing version comment, overwriting it", "wiki_title", pageTitle, "version", requiredVersion)
+		return w.Push(ctx, pageTitle, content, "Updating Roapid module to version "+requiredVersion)
 	}
 
 	existingVersion := strings.TrimSpace(strings.TrimPrefix(firstLine, "-- "))
 	if existingVersion != requiredVersion {
-		log.Printf("Updating %s: version %s → %s", pageTitle, existingVersion, requiredVersion)
-		return w.Push(pageTitle, content, "Updating Roapid module from "+existingVersion+" to "+requiredVersion)
+		w.logger.Info("updating module page", "wiki_title", pageTitle, "from_version", existingVersion, "version", requiredVersion)
+		return w.Push(ctx, pageTitle, content, "Updating Roapid module from "+existingVersion+" to "+requiredVersion)
 	}
 
-	log.Printf("Page %s is up to date (version %s).", pageTitle, requiredVersion)
+	w.logger.Info("module page is up to date", "wiki_title", pageTitle, "version", requiredVersion)
 	return nil
 }
 
-func (w *WikiClient) GetCategoriesWithPrefix(prefix string) ([]string, error) {
+func (w *WikiClient) GetCategoriesWithPrefix(ctx context.Context, prefix string) ([]Category, error) {
 	if prefix == "" {
 		return nil, errors.New("prefix cannot be empty")
 	}
@@ -294,38 +384,295 @@ func (w *WikiClient) GetCategoriesWithPrefix(prefix string) ([]string, error) {
 		"action":        "query",
 		"list":          "allcategories",
 		"acprefix":      acPrefix,
+		"acprop":        "size",
 		"aclimit":       "max",
 		"format":        "json",
 		"formatversion": "2",
+		"continue":      "",
+	}
+
+	// callers treat missing categories as empty, so a partial listing is an error
+	var categories []Category
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		respBody, err := w.client.GetRaw(p)
+		if err != nil {
+			return nil, err
+		}
+		w.logRawJSON("GetCategoriesWithPrefix response", respBody)
+
+		var res mwAllCategoriesResponse
+		if err := json.Unmarshal(respBody, &res); err != nil {
+			return nil, fmt.Errorf("error parsing allcategories response: %w", err)
+		}
+		for _, cat := range res.Query.AllCategories {
+			name := cat.Category
+			if name == "" {
+				name = cat.Star
+			}
+			if name == "" {
+				continue
+			}
+			categories = append(categories, Category{Title: "Category:" + name, Members: cat.Size})
+		}
+
+		if len(res.Continue) == 0 {
+			return categories, nil
+		}
+		for k, v := range res.Continue {
+			p[k] = v
+		}
+	}
+}
+
+// GetEmbeddedTemplates finds the pages embedding embeddedTitle and returns the
+// pages they transclude whose titles start with prefix (first letter case
+// insensitive), each with the number of embedding pages using it. Pages read
+// through mw.loadJsonData count as transcluded, even when they don't exist.
+func (w *WikiClient) GetEmbeddedTemplates(ctx context.Context, embeddedTitle, prefix string) ([]Category, error) {
+	if prefix == "" {
+		return nil, errors.New("prefix cannot be empty")
+	}
+	p := params.Values{
+		"generator": "embeddedin",
+		"geititle":  embeddedTitle,
+		"geilimit":  "max",
+		"prop":      "templates",
+		"tllimit":   "max",
+	}
+	users := make(map[string]map[int64]bool)
+	if err := w.queryPageLinks(ctx, p, prefix, users); err != nil {
+		return nil, err
+	}
+	return countLinks(users), nil
+}
+
+// GetPagesTemplates is GetEmbeddedTemplates for the given pages only.
+func (w *WikiClient) GetPagesTemplates(ctx context.Context, titles []string, prefix string) ([]Category, error) {
+	return w.getPagesLinks(ctx, titles, prefix, params.Values{"prop": "templates", "tllimit": "max"})
+}
+
+// GetPagesCategoriesWithPrefix returns the categories starting with prefix
+// that the given pages are in, each with the number of those pages in it.
+func (w *WikiClient) GetPagesCategoriesWithPrefix(ctx context.Context, titles []string, prefix string) ([]Category, error) {
+	if prefix == "" {
+		return nil, errors.New("prefix cannot be empty")
+	}
+	return w.getPagesLinks(ctx, titles, "Category:"+strings.ToUpper(prefix[:1])+prefix[1:], params.Values{"prop": "categories", "cllimit": "max"})
+}
+
+func (w *WikiClient) getPagesLinks(ctx context.Context, titles []string, prefix string, base params.Values) ([]Category, error) {
+	users := make(map[string]map[int64]bool)
+	for batch := range slices.Chunk(titles, 50) {
+		p := maps.Clone(base)
+		p["titles"] = strings.Join(batch, "|")
+		if err := w.queryPageLinks(ctx, p, prefix, users); err != nil {
+			return nil, err
+		}
+	}
+	return countLinks(users), nil
+}
+
+// queryPageLinks runs a query listing the templates or categories of pages,
+// following continuations, and records which pages link to each title
+// starting with prefix.
+func (w *WikiClient) queryPageLinks(ctx context.Context, p params.Values, prefix string, users map[string]map[int64]bool) error {
+	p["action"] = "query"
+	p["format"] = "json"
+	p["formatversion"] = "2"
+	p["continue"] = ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		respBody, err := w.client.GetRaw(p)
+		if err != nil {
+			return err
+		}
+		w.logRawJSON("page links response", respBody)
+
+		var res mwPageLinksResponse
+		if err := json.Unmarshal(respBody, &res); err != nil {
+			return err
+		}
+		for _, page := range res.Query.Pages {
+			for _, link := range slices.Concat(page.Templates, page.Categories) {
+				if !hasTitlePrefix(link.Title, prefix) {
+					continue
+				}
+				if users[link.Title] == nil {
+					users[link.Title] = make(map[int64]bool)
+				}
+				users[link.Title][page.PageID] = true
+			}
+		}
+
+		if len(res.Continue) == 0 {
+			return nil
+		}
+		for k, v := range res.Continue {
+			p[k] = v
+		}
+	}
+}
+
+func countLinks(users map[string]map[int64]bool) []Category {
+	links := make([]Category, 0, len(users))
+	for title, pages := range users {
+		links = append(links, Category{Title: title, Members: len(pages)})
+	}
+	return links
+}
+
+// hasTitlePrefix compares the namespace case insensitively and the first
+// letter of the page name too, as MediaWiki capitalizes it.
+func hasTitlePrefix(title, prefix string) bool {
+	if len(title) < len(prefix) {
+		return false
+	}
+	ns, name, ok := strings.Cut(prefix, ":")
+	if !ok || name == "" {
+		return strings.EqualFold(title[:len(prefix)], prefix)
+	}
+	return strings.EqualFold(title[:len(ns)+2], prefix[:len(ns)+2]) && title[len(ns)+2:len(prefix)] == name[1:]
+}
+
+// GetEmbeddedIn lists the pages transcluding title.
+func (w *WikiClient) GetEmbeddedIn(ctx context.Context, title string) ([]string, error) {
+	p := params.Values{
+		"action":        "query",
+		"list":          "embeddedin",
+		"eititle":       title,
+		"eilimit":       "max",
+		"format":        "json",
+		"formatversion": "2",
+		"continue":      "",
+	}
+
+	var titles []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		respBody, err := w.client.GetRaw(p)
+		if err != nil {
+			return nil, err
+		}
+		w.logRawJSON("GetEmbeddedIn response", respBody)
+
+		var res mwEmbeddedInResponse
+		if err := json.Unmarshal(respBody, &res); err != nil {
+			return nil, err
+		}
+		for _, page := range res.Query.EmbeddedIn {
+			if page.Title != "" {
+				titles = append(titles, page.Title)
+			}
+		}
+
+		if len(res.Continue) == 0 {
+			return titles, nil
+		}
+		for k, v := range res.Continue {
+			p[k] = v
+		}
 	}
+}
 
+// LatestChange returns a cursor at the wiki's most recent change.
+func (w *WikiClient) LatestChange(ctx context.Context) (RCCursor, error) {
+	if err := ctx.Err(); err != nil {
+		return RCCursor{}, err
+	}
+	p := params.Values{
+		"action":        "query",
+		"list":          "recentchanges",
+		"rcprop":        "ids|timestamp",
+		"rclimit":       "1",
+		"format":        "json",
+		"formatversion": "2",
+	}
 	respBody, err := w.client.GetRaw(p)
 	if err != nil {
-		return nil, err
+		return RCCursor{}, err
 	}
-	w.logRawJSON("GetCategoriesWithPrefix response", respBody)
+	w.logRawJSON("LatestChange response", respBody)
 
-	var res mwAllCategoriesResponse
+	var res mwRecentChangesResponse
 	if err := json.Unmarshal(respBody, &res); err != nil {
-		return []string{}, nil
+		return RCCursor{}, err
+	}
+	if len(res.Query.RecentChanges) == 0 {
+		return RCCursor{}, nil
+	}
+	rc := res.Query.RecentChanges[0]
+	return RCCursor{ID: rc.RCID, Timestamp: rc.Timestamp}, nil
+}
+
+// RecentChanges lists the pages edited, created or logged (deleted, moved...)
+// after since, and returns a cursor at the last change seen.
+func (w *WikiClient) RecentChanges(ctx context.Context, since RCCursor) ([]string, RCCursor, error) {
+	p := params.Values{
+		"action":        "query",
+		"list":          "recentchanges",
+		"rcprop":        "ids|title|timestamp",
+		"rctype":        "edit|new|log",
+		"rcdir":         "newer",
+		"rclimit":       "max",
+		"format":        "json",
+		"formatversion": "2",
+		"continue":      "",
+	}
+	if since.Timestamp != "" {
+		p["rcstart"] = since.Timestamp
 	}
 
+	seen := make(map[string]bool)
 	var titles []string
-	for _, cat := range res.Query.AllCategories {
-		name := cat.Category
-		if name == "" {
-			name = cat.Star
+	last := since
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, since, err
 		}
-		if name == "" {
-			continue
+		respBody, err := w.client.GetRaw(p)
+		if err != nil {
+			return nil, since, err
 		}
-		titles = append(titles, "Category:"+name)
-	}
+		w.logRawJSON("RecentChanges response", respBody)
 
-	return titles, nil
+		var res mwRecentChangesResponse
+		if err := json.Unmarshal(respBody, &res); err != nil {
+			return nil, since, err
+		}
+		for _, rc := range res.Query.RecentChanges {
+			// rcstart is inclusive and timestamps only have second precision
+			if rc.RCID <= since.ID {
+				continue
+			}
+			if rc.RCID > last.ID {
+				last = RCCursor{ID: rc.RCID, Timestamp: rc.Timestamp}
+			}
+			if rc.Title != "" && !seen[rc.Title] {
+				seen[rc.Title] = true
+				titles = append(titles, rc.Title)
+			}
+		}
+
+		if len(res.Continue) == 0 {
+			return titles, last, nil
+		}
+		for k, v := range res.Continue {
+			p[k] = v
+		}
+	}
 }
 
-func (w *WikiClient) GetCategoryMembers(category string) ([]string, error) {
+func (w *WikiClient) GetCategoryMembers(ctx context.Context, category string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if category == "" {
 		return nil, errors.New("category cannot be empty")
 	}
@@ -363,25 +710,73 @@ func (w *WikiClient) GetCategoryMembers(category string) ([]string, error) {
 	return titles, nil
 }
 
-func (w *WikiClient) PurgePages(titles []string) error {
+func (w *WikiClient) PurgePages(ctx context.Context, titles []string) error {
 	if len(titles) == 0 {
 		return nil
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	p := params.Values{
 		"action": "purge",
 		"titles": strings.Join(titles, "|"),
 		"format": "json",
 	}
 	_, err := w.client.Post(p)
-	return err
+	if err != nil {
+		metrics.WikiPurges.Inc(w.host, "failed")
+		return err
+	}
+	metrics.WikiPurges.Inc(w.host, "purged")
+	return nil
 }
 
-func (w *WikiClient) PurgeCategoryMembers(category string) error {
-	titles, err := w.GetCategoryMembers(category)
+func (w *WikiClient) PurgeCategoryMembers(ctx context.Context, category string) error {
+	titles, err := w.GetCategoryMembers(ctx, category)
 	if err != nil {
 		return err
 	}
-	return w.PurgePages(titles)
+	return w.PurgePages(ctx, titles)
+}
+
+func (w *WikiClient) PurgeEmbeddingPages(ctx context.Context, title string) error {
+	titles, err := w.GetEmbeddedIn(ctx, title)
+	if err != nil {
+		return err
+	}
+	return w.PurgePages(ctx, titles)
+}
+
+func (w *WikiClient) Delete(ctx context.Context, title, reason string) error {
+	if err := w.throttleEdit(ctx); err != nil {
+		return err
+	}
+	token, err := w.getCSRFToken(false)
+	if err != nil {
+		return err
+	}
+
+	p := params.Values{
+		"action": "delete",
+		"title":  title,
+		"reason": reason,
+		"token":  token,
+	}
+	_, err = w.client.Post(p)
+	if err != nil && isBadTokenError(err) {
+		token, tokenErr := w.getCSRFToken(true)
+		if tokenErr != nil {
+			return tokenErr
+		}
+		p["token"] = token
+		_, err = w.client.Post(p)
+	}
+	if err != nil {
+		w.logger.Error("failed to delete page", "wiki_title", title, "err", err)
+		return err
+	}
+	w.logger.Info("deleted page", "wiki_title", title)
+	return nil
 }
 
 func (w *WikiClient) getCSRFToken(forceRefresh bool) (string, error) {
@@ -396,6 +791,7 @@ func (w *WikiClient) getCSRFToken(forceRefresh bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	metrics.WikiTokenRefreshes.Inc(w.host)
 	w.csrfToken = token
 	return token, nil
 }
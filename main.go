@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"log"
-	"maps"
+	"log/slog"
+	"net/http"
+	"os"
 	"os/signal"
 	"strings"
 	"sync"
@@ -12,320 +13,514 @@ import (
 
 	prog "robloxapid/internal"
 	"robloxapid/internal/config"
+	"robloxapid/internal/fetcher"
+	"robloxapid/internal/logging"
+	"robloxapid/internal/metrics"
+	"robloxapid/internal/server"
 	"robloxapid/internal/wiki"
 )
 
-const roapiModuleVersion = "0.0.18"
+const roapiModuleVersion = "0.0.27"
 const maxEndpointWorkers = 6
 
-var roapiModuleContent = wiki.RoapidLua
-
 type refreshTask struct {
-	category     string
+	key          string
 	endpointType string
 	id           string
+	targets      []prog.Target
 	startLog     string
 	errorPrefix  string
+	// fresh skips cached Roblox responses
+	fresh bool
+}
+
+func renderRoapiModule(wikiCfg config.WikiConfig) string {
+	content := wiki.RoapidLua
+	content = strings.ReplaceAll(content, "{{NAMESPACE}}", wikiCfg.Namespace)
+	content = strings.ReplaceAll(content, "{{CATEGORY_PREFIX}}", wikiCfg.CategoryPrefix)
+	content = strings.ReplaceAll(content, "{{DISCOVERY}}", wikiCfg.Discovery)
+
+	queueNote := wikiCfg.LuaMessages.QueueNote
+	if queueNote == "" {
+		queueNote = "Publish this page and wait at least a minute for data to be fetched."
+	}
+	content = strings.ReplaceAll(content, "{{MSG_QUEUE_NOTE}}", queueNote)
+
+	fpnf := wikiCfg.LuaMessages.FieldPathNotFound
+	if fpnf == "" {
+		fpnf = "Field path not found (%s), [[%s|see fields]]."
+	}
+	content = strings.ReplaceAll(content, "{{MSG_FIELD_PATH_NOT_FOUND}}", fpnf)
+	return content
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	defer stop()
 
-	log.Println("--- RobloxAPID ---")
-	log.Println("Description: A daemon that bridges the Roblox API to Fandom wikis.")
-	log.Println("Source: https://github.com/paradoxum-wikis/RobloxAPID")
-	log.Println("--------------------")
-
 	cfg, err := config.LoadConfig("config/config.json")
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("failed to load config", "err", err)
 	}
 
-	wikiClient, err := wiki.NewWikiClient(cfg.Wiki.APIURL, cfg.Wiki.Username, cfg.Wiki.Password, cfg.Wiki.Debug)
+	drainTimeout, err := cfg.GetDrainTimeout()
 	if err != nil {
-		log.Fatalf("Failed to create wiki client: %v", err)
+		fatal("invalid drain timeout", "err", err)
 	}
 
-	roapiModuleContent = strings.ReplaceAll(roapiModuleContent, "{{NAMESPACE}}", cfg.Wiki.Namespace)
-	roapiModuleContent = strings.ReplaceAll(roapiModuleContent, "{{CATEGORY_PREFIX}}", cfg.DynamicEndpoints.CategoryPrefix)
+	// workCtx outlives ctx by up to the drain timeout, so in-flight fetches and
+	// wiki pushes can finish after a shutdown signal before they are aborted.
+	// Wiki clients abort their requests when it ends, so until startup is done a
+	// shutdown signal ends it right away: there is nothing to drain yet.
+	workCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	startupAbort := context.AfterFunc(ctx, abort)
+
+	// startupFatal exits quietly when startup failed because it was aborted.
+	startupFatal := func(msg string, args ...any) {
+		if ctx.Err() != nil {
+			slog.Info("shutdown signal received during startup")
+			os.Exit(0)
+		}
+		fatal(msg, args...)
+	}
 
-	queueNote := cfg.LuaMessages.QueueNote
-	if queueNote == "" {
-		queueNote = "Publish this page and wait at least a minute for data to be fetched."
+	logFile, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fatal("failed to set up logging", "err", err)
 	}
-	roapiModuleContent = strings.ReplaceAll(roapiModuleContent, "{{MSG_QUEUE_NOTE}}", queueNote)
+	defer logFile.Close()
 
-	fpnf := cfg.LuaMessages.FieldPathNotFound
-	if fpnf == "" {
-		fpnf = "Field path not found (%s), [[%s|see fields]]."
+	slog.Info("RobloxAPID, a daemon that bridges the Roblox API to Fandom wikis.", "source", "https://github.com/paradoxum-wikis/RobloxAPID")
+
+	var workers sync.WaitGroup
+
+	// the control server starts first so probes answer while wikis log in
+	health := server.NewHealth()
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", health.LivenessHandler())
+	mux.Handle("GET /readyz", health.ReadinessHandler())
+	if cfg.Server.ListenAddress != "" {
+		workers.Go(func() {
+			if err := server.Run(ctx, cfg.Server.ListenAddress, mux); err != nil {
+				slog.Error("control server failed", "err", err)
+			}
+		})
 	}
-	roapiModuleContent = strings.ReplaceAll(roapiModuleContent, "{{MSG_FIELD_PATH_NOT_FOUND}}", fpnf)
 
-	err = wikiClient.SetupRoapiModule(cfg.Wiki.Namespace+":Roapid", roapiModuleVersion, roapiModuleContent)
-	if err != nil {
-		log.Fatalf("Failed to setup Roapid module on wiki: %v", err)
+	var sites []*prog.Site
+	for _, wikiCfg := range cfg.GetWikis() {
+		sites = append(sites, &prog.Site{Name: wikiCfg.Name, Config: wikiCfg})
+	}
+	for _, site := range sites {
+		health.Require("login "+site.String(), "module "+site.String(), "category scan "+site.String())
+	}
+
+	for _, site := range sites {
+		wikiCfg := site.Config
+		wikiClient, err := wiki.NewWikiClient(workCtx, wikiCfg.APIURL, wikiCfg.Username, wikiCfg.Password, wikiCfg.Debug)
+		if err != nil {
+			startupFatal("failed to create wiki client", "api_url", wikiCfg.APIURL, "err", err)
+		}
+		site.Client = wikiClient
+		health.Pass("login " + site.String())
+
+		err = wikiClient.SetupRoapiModule(ctx, site.ModuleTitle(), roapiModuleVersion, renderRoapiModule(wikiCfg))
+		if err != nil {
+			startupFatal("failed to set up Roapid module", "api_url", wikiCfg.APIURL, "err", err)
+		}
+		health.Pass("module " + site.String())
 	}
 
 	// intervals
 	categoryInterval, err := cfg.GetCategoryCheckInterval()
 	if err != nil {
-		log.Fatalf("Invalid category check interval: %v", err)
+		fatal("invalid category check interval", "err", err)
+	}
+
+	fullScanInterval, err := cfg.GetFullScanInterval()
+	if err != nil {
+		fatal("invalid full scan interval", "err", err)
+	}
+
+	statusInterval, err := cfg.GetStatusInterval()
+	if err != nil {
+		fatal("invalid status interval", "err", err)
 	}
 
 	dataInterval, err := cfg.GetDataRefreshInterval()
 	if err != nil {
-		log.Fatalf("Invalid data refresh interval: %v", err)
+		fatal("invalid data refresh interval", "err", err)
+	}
+
+	fetchCacheTTL, err := cfg.GetFetchCacheTTL()
+	if err != nil {
+		fatal("invalid fetch cache TTL", "err", err)
+	}
+	fetcher.SetCacheTTL(fetchCacheTTL)
+
+	orphanGrace, err := cfg.GetOrphanGracePeriod()
+	if err != nil {
+		fatal("invalid orphan grace period", "err", err)
 	}
 
 	aboutInterval, err := cfg.GetRefreshInterval("about")
 	if err != nil {
-		log.Printf("Invalid about refresh interval: %v; falling back to %v", err, dataInterval)
+		slog.Warn("invalid about refresh interval, falling back to the default", "err", err, "interval", dataInterval)
 		aboutInterval = dataInterval
 	}
 
 	documentationInterval, err := cfg.GetRefreshInterval("badges")
 	if err != nil {
-		log.Printf("Invalid documentation refresh interval: %v; falling back to %v", err, dataInterval)
+		slog.Warn("invalid documentation refresh interval, falling back to the default", "err", err, "interval", dataInterval)
 		documentationInterval = dataInterval
 	}
 
-	log.Printf("Starting with intervals: categories every %v, default refresh every %v", categoryInterval, dataInterval)
+	slog.Info("starting", "wikis", len(sites), "category_interval", categoryInterval, "refresh_interval", dataInterval)
 
-	if err := prog.ProcessAboutEndpoint(wikiClient, cfg); err != nil {
-		log.Printf("Initial about sync failed: %v", err)
+	syncAbout := func(label string) {
+		for _, site := range sites {
+			if err := prog.ProcessAboutEndpoint(ctx, site); err != nil {
+				slog.Error(label+" about sync failed", "wiki", site.String(), "err", err)
+			}
+		}
 	}
-	if err := prog.SyncStaticDocs(wikiClient, cfg); err != nil {
-		log.Printf("Initial documentation sync failed: %v", err)
+
+	syncDocs := func(label string) {
+		for _, site := range sites {
+			if err := prog.SyncStaticDocs(ctx, site); err != nil {
+				slog.Error(label+" documentation sync failed", "wiki", site.String(), "err", err)
+			}
+		}
+	}
+
+	syncAbout("initial")
+	syncDocs("initial")
+	if ctx.Err() != nil {
+		slog.Info("shutdown signal received during startup")
+		return
+	}
+	// refreshes start below, from now on they get the drain timeout
+	startupAbort()
+
+	scheduler := prog.NewScheduler(cfg)
+	policy := prog.NewPolicy(cfg)
+	admitAlias := func(targets []prog.Target, endpointType, aliasID, id string) []prog.Target {
+		return policy.AdmitAlias(scheduler, targets, endpointType, aliasID, id)
 	}
 
-	processedEndpoints := make(map[string]*prog.EndpointState)
 	var mu sync.Mutex
-	var workers sync.WaitGroup
 	inFlight := make(map[string]struct{})
 
-	tryStartCategory := func(category string) bool {
+	tryStartEndpoint := func(key string) bool {
 		mu.Lock()
 		defer mu.Unlock()
-		if _, exists := inFlight[category]; exists {
+		if _, exists := inFlight[key]; exists {
 			return false
 		}
-		inFlight[category] = struct{}{}
+		inFlight[key] = struct{}{}
+		metrics.InFlight.Set(float64(len(inFlight)))
 		return true
 	}
 
-	finishCategory := func(category string) {
+	finishEndpoint := func(key string) {
 		mu.Lock()
-		delete(inFlight, category)
+		delete(inFlight, key)
+		metrics.InFlight.Set(float64(len(inFlight)))
 		mu.Unlock()
 	}
 
-	runRefreshTasks := func(tasks []refreshTask) {
-		if len(tasks) == 0 {
-			return
+	// stateTask builds a refresh task targeting every site tracking key.
+	stateTask := func(key string) (refreshTask, bool) {
+		state, ok := scheduler.Lookup(key)
+		if !ok || len(state.Categories) == 0 {
+			return refreshTask{}, false
 		}
+		return refreshTask{
+			key:          key,
+			endpointType: state.EndpointType,
+			id:           state.ID,
+			targets:      state.Targets(),
+			startLog:     "refreshing endpoint",
+			errorPrefix:  "refreshing",
+		}, true
+	}
 
-		workerCount := min(len(tasks), maxEndpointWorkers)
-
-		jobCh := make(chan refreshTask)
-		var wg sync.WaitGroup
-		for range workerCount {
-			wg.Go(func() {
-				for task := range jobCh {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-					}
-
-					if !tryStartCategory(task.category) {
-						log.Printf("[DEBUG] refresh: skipping %s (already in progress)", task.category)
-						continue
-					}
-
-					func() {
-						defer finishCategory(task.category)
-						if task.startLog != "" {
-							log.Print(task.startLog)
-						}
-						if err := prog.ProcessEndpoint(wikiClient, cfg, task.endpointType, task.id, task.category); err != nil {
-							log.Printf("Error %s endpoint %s: %v", task.errorPrefix, task.category, err)
-							return
-						}
-						prog.UpdateSchedule(processedEndpoints, &mu, task.category, task.endpointType, cfg, time.Time{})
-					}()
-				}
-			})
+	// runTask refreshes one endpoint unless it is already being refreshed.
+	runTask := func(task refreshTask) {
+		logger := slog.With("endpoint_type", task.endpointType, "id", task.id)
+		if !tryStartEndpoint(task.key) {
+			logger.Debug("skipping refresh, already in progress")
+			return
 		}
+		defer finishEndpoint(task.key)
 
-		for _, task := range tasks {
-			jobCh <- task
+		if task.startLog != "" {
+			logger.Info(task.startLog)
 		}
-		close(jobCh)
-		wg.Wait()
-	}
-
-	startTicker := func(interval time.Duration, name string, fn func()) {
-		if interval <= 0 {
+		taskCtx := workCtx
+		if task.fresh {
+			taskCtx = fetcher.WithoutCache(workCtx)
+		}
+		start := time.Now()
+		err := prog.ProcessEndpoint(taskCtx, task.targets, cfg, admitAlias, task.endpointType, task.id)
+		metrics.EndpointDuration.Observe(time.Since(start).Seconds(), task.endpointType)
+		scheduler.Reschedule(task.endpointType, task.id, err)
+		if err != nil {
+			metrics.EndpointRefreshes.Inc(task.endpointType, "failed")
+			logger.Error("error "+task.errorPrefix+" endpoint", "err", err)
 			return
 		}
+		metrics.EndpointRefreshes.Inc(task.endpointType, "succeeded")
+		metrics.EndpointLastSuccess.Set(time.Now(), task.endpointType, task.id)
+	}
+
+	// one long-lived pool runs every refresh, so overlapping scheduler wake-ups,
+	// category scans and webhooks never fetch more than maxEndpointWorkers at once
+	taskCh := make(chan refreshTask)
+	for range maxEndpointWorkers {
 		workers.Go(func() {
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
 			for {
 				select {
 				case <-ctx.Done():
-					log.Printf("%s ticker stopping", name)
 					return
-				case <-ticker.C:
-					fn()
+				case task := <-taskCh:
+					metrics.QueueDepth.Add(-1)
+					if ctx.Err() != nil {
+						continue
+					}
+					runTask(task)
 				}
 			}
 		})
 	}
 
-	prog.BootstrapFromData(processedEndpoints, &mu, cfg)
-
-	{
-		now := time.Now()
-		type toRef struct{ category, endpointType, id string }
-		var immediate []toRef
+	// enqueue hands tasks to the pool and returns once every task was taken, or
+	// when shutdown starts.
+	enqueue := func(tasks []refreshTask) {
+		if len(tasks) == 0 {
+			return
+		}
 
-		mu.Lock()
-		for category, st := range processedEndpoints {
-			if !st.NextRun.IsZero() && !now.Before(st.NextRun) {
-				et, id, err := prog.ParseCategory(category, cfg.DynamicEndpoints.CategoryPrefix)
-				if err != nil {
-					continue
-				}
-				immediate = append(immediate, toRef{category, et, id})
+		var thumbnailIDs []string
+		for _, task := range tasks {
+			if task.endpointType == "thumbnails" {
+				thumbnailIDs = append(thumbnailIDs, task.id)
 			}
 		}
-		mu.Unlock()
+		prog.PrefetchThumbnails(workCtx, cfg, thumbnailIDs)
 
-		sem := make(chan struct{}, 10)
-		for _, r := range immediate {
-			workers.Add(1)
-			go func(r toRef) {
-				sem <- struct{}{}
-				defer func() { <-sem }()
-				defer workers.Done()
+		metrics.QueueDepth.Add(float64(len(tasks)))
+		sent := 0
+	send:
+		for _, task := range tasks {
+			select {
+			case taskCh <- task:
+				sent++
+			case <-ctx.Done():
+				break send
+			}
+		}
+		metrics.QueueDepth.Add(-float64(len(tasks) - sent))
+	}
 
-				select {
-				case <-ctx.Done():
-					log.Printf("[DEBUG] bootstrap: skipping %s due to shutdown", r.category)
-					return
-				default:
-				}
+	// every runs fn periodically from the scheduler and watches it for liveness.
+	every := func(interval time.Duration, name string, fn func()) {
+		if interval <= 0 {
+			return
+		}
+		health.Watch(name, interval)
+		scheduler.Every(name, interval, func() {
+			health.Beat(name)
+			fn()
+			health.Beat(name)
+		})
+	}
 
-				if !tryStartCategory(r.category) {
-					log.Printf("[DEBUG] bootstrap: skipping %s (already in progress)", r.category)
-					return
-				}
-				defer finishCategory(r.category)
+	refreshDue := func(keys []string) {
+		tasks := make([]refreshTask, 0, len(keys))
+		for _, key := range keys {
+			if task, ok := stateTask(key); ok {
+				tasks = append(tasks, task)
+			}
+		}
+		enqueue(tasks)
+	}
 
-				log.Printf("[DEBUG] bootstrap: immediate refresh %s", r.category)
-				if err := prog.ProcessEndpoint(wikiClient, cfg, r.endpointType, r.id, r.category); err != nil {
-					log.Printf("Error refreshing bootstrapped endpoint %s: %v", r.category, err)
-					return
-				}
-				prog.UpdateSchedule(processedEndpoints, &mu, r.category, r.endpointType, cfg, time.Time{})
-			}(r)
+	for _, site := range sites {
+		if err := policy.LoadPage(ctx, site); err != nil {
+			slog.Error("error loading policy page", "wiki", site.String(), "err", err)
 		}
 	}
+	scheduler.Bootstrap(sites, policy)
 
-	checkCategories := func() {
-		log.Println("Checking for new wanted categories...")
+	discovery := prog.NewDiscovery(fullScanInterval)
 
-		categories, err := wikiClient.GetCategoriesWithPrefix(cfg.DynamicEndpoints.CategoryPrefix)
-		if err != nil {
-			log.Printf("Error fetching queue categories: %v", err)
-			return
-		}
+	checkCategories := func() {
+		slog.Info("checking for new wanted categories")
 
-		now := time.Now()
-		tasks := make([]refreshTask, 0, len(categories))
-		for _, category := range categories {
-			endpointType, id, err := prog.ParseCategory(category, cfg.DynamicEndpoints.CategoryPrefix)
+		tasks := make(map[string]*refreshTask)
+		for _, site := range sites {
+			categories, fullScan, err := discovery.Scan(ctx, site)
 			if err != nil {
-				log.Printf("Error parsing category %s: %v", category, err)
+				slog.Error("error fetching queue categories", "wiki", site.String(), "err", err)
 				continue
 			}
+			health.Pass("category scan " + site.String())
 
-			mu.Lock()
-			state, exists := processedEndpoints[category]
-			mu.Unlock()
-
-			if !exists {
-				tasks = append(tasks, refreshTask{
-					category:     category,
-					endpointType: endpointType,
-					id:           id,
-					errorPrefix:  "processing new",
-				})
-			} else if now.After(state.NextRun) {
-				tasks = append(tasks, refreshTask{
-					category:     category,
-					endpointType: state.EndpointType,
-					id:           id,
-					startLog:     "Refreshing endpoint " + category + "...",
-					errorPrefix:  "refreshing",
-				})
+			if err := policy.LoadPage(ctx, site); err != nil {
+				slog.Error("error loading policy page", "wiki", site.String(), "err", err)
 			}
-		}
-		runRefreshTasks(tasks)
-	}
 
-	checkCategories()
+			members := make(map[string]int)
+			seen := make(map[string]bool)
+			for _, cat := range categories {
+				category := cat.Title
+				seen[category] = true
+				endpointType, id, err := site.ParseQueueTitle(category, cfg.DynamicEndpoints.APIMap)
+				if err != nil {
+					// pages embedding the module also load the about and documentation pages
+					if site.Config.Discovery != config.DiscoveryEmbeddedIn {
+						slog.Warn("error parsing category", "wiki", site.String(), "category", category, "err", err)
+						policy.Reject(site, category, "", "", err)
+					}
+					continue
+				}
+				key := prog.EndpointKey(endpointType, id)
+				members[key] += cat.Members
 
-	startTicker(aboutInterval, "about sync", func() {
-		if err := prog.ProcessAboutEndpoint(wikiClient, cfg); err != nil {
-			log.Printf("Scheduled about sync failed: %v", err)
-		}
-	})
+				if err := policy.Check(site, endpointType, id); err != nil {
+					policy.Reject(site, category, endpointType, id, err)
+					scheduler.Untrack(site, endpointType, id)
+					continue
+				}
 
-	startTicker(documentationInterval, "documentation sync", func() {
-		if err := prog.SyncStaticDocs(wikiClient, cfg); err != nil {
-			log.Printf("Scheduled documentation sync failed: %v", err)
-		}
-	})
+				// with orphan cleanup on, empty categories don't start tracking
+				if fullScan && orphanGrace > 0 && cat.Members == 0 {
+					if _, tracked := scheduler.Lookup(key); !tracked {
+						continue
+					}
+				}
 
-	startTicker(categoryInterval, "category scan", checkCategories)
+				if err := scheduler.CanTrack(endpointType, id); err != nil {
+					policy.Reject(site, category, endpointType, id, err)
+					continue
+				}
+				policy.Accept(site, category)
 
-	startTicker(dataInterval, "data refresh", func() {
-		log.Println("Refreshing existing data...")
+				isNewForSite, scheduled := scheduler.Track(site, category, endpointType, id)
+				if scheduled && !isNewForSite {
+					continue
+				}
 
-		mu.Lock()
-		endpointsToRefresh := maps.Clone(processedEndpoints)
-		mu.Unlock()
+				// new endpoints only need pushing to the sites that just started tracking them
+				task, ok := tasks[key]
+				if !ok {
+					task = &refreshTask{
+						key:          key,
+						endpointType: endpointType,
+						id:           id,
+						errorPrefix:  "processing new",
+					}
+					tasks[key] = task
+				}
+				task.targets = append(task.targets, prog.Target{Site: site, Category: category})
+			}
 
-		now := time.Now()
-		tasks := make([]refreshTask, 0, len(endpointsToRefresh))
-		for category, state := range endpointsToRefresh {
-			if now.Before(state.NextRun) {
-				log.Printf("[DEBUG] refresh: skipping %s (nextRun %v)", category, state.NextRun)
-				continue
+			// incremental scans only see changed pages, so only full scans can tell a category is empty
+			if fullScan && orphanGrace > 0 {
+				for _, orphan := range scheduler.SweepOrphans(site, members, orphanGrace, time.Now()) {
+					slog.Info("dropping orphaned endpoint", "wiki", site.String(), "category", orphan.Category, "endpoint_type", orphan.EndpointType, "id", orphan.ID)
+					if err := prog.CleanupOrphan(ctx, cfg, orphan); err != nil {
+						slog.Error("error cleaning up orphaned endpoint", "wiki", site.String(), "category", orphan.Category, "err", err)
+					}
+				}
 			}
 
-			endpointType, id, err := prog.ParseCategory(category, cfg.DynamicEndpoints.CategoryPrefix)
-			if err != nil {
-				log.Printf("Error parsing category %s: %v", category, err)
+			if fullScan {
+				policy.RetainRejections(site, seen)
+			}
+		}
+
+		queued := make([]refreshTask, 0, len(tasks))
+		for _, task := range tasks {
+			queued = append(queued, *task)
+		}
+		// the pool refreshes them, so a long queue doesn't hold up the scan job
+		// and its liveness beat
+		if len(queued) > 0 {
+			workers.Go(func() { enqueue(queued) })
+		}
+	}
+
+	refreshUniverse := func(req server.RefreshRequest) int {
+		var tasks []refreshTask
+		for _, key := range scheduler.Keys() {
+			task, ok := stateTask(key)
+			if !ok || !prog.EndpointMatchesUniverse(cfg, task.endpointType, task.id, req.UniverseID, req.PlaceID) {
 				continue
 			}
+			task.startLog = "webhook refreshing endpoint"
+			task.errorPrefix = "webhook refreshing"
+			task.fresh = true
+			tasks = append(tasks, task)
+		}
+		if len(tasks) > 0 {
+			workers.Go(func() { enqueue(tasks) })
+		}
+		return len(tasks)
+	}
+
+	if cfg.Server.ListenAddress != "" {
+		if cfg.Server.Webhook.Secret != "" {
+			webhookPath := cfg.Server.Webhook.Path
+			if webhookPath == "" {
+				webhookPath = "/webhook"
+			}
+			mux.Handle("POST "+webhookPath, server.NewWebhookHandler(cfg.Server.Webhook.Secret, refreshUniverse))
+		} else {
+			slog.Info("webhook secret not configured, webhook refresh disabled")
+		}
+	}
 
-			tasks = append(tasks, refreshTask{
-				category:     category,
-				endpointType: endpointType,
-				id:           id,
-				startLog:     "Refreshing endpoint " + category + "...",
-				errorPrefix:  "refreshing",
-			})
+	every(aboutInterval, "about sync", func() { syncAbout("scheduled") })
+	every(documentationInterval, "documentation sync", func() { syncDocs("scheduled") })
+	every(categoryInterval, "category scan", checkCategories)
+	every(statusInterval, "status page", func() {
+		for _, site := range sites {
+			status := prog.BuildStatus(scheduler, policy, site)
+			if err := prog.PublishStatus(ctx, site, status, cfg.Server.StatusReportPage); err != nil {
+				slog.Error("error publishing status page", "wiki", site.String(), "err", err)
+			}
 		}
-		runRefreshTasks(tasks)
 	})
 
+	health.Watch("scheduler", prog.SchedulerHeartbeat)
+	workers.Go(func() {
+		scheduler.Run(ctx, &workers, refreshDue, func() { health.Beat("scheduler") })
+	})
+
+	checkCategories()
+
 	<-ctx.Done()
-	log.Println("Shutdown signal received, waiting for workers to finish...")
-	workers.Wait()
-	log.Println("Shutdown complete.")
+	slog.Info("shutdown signal received, draining in-flight work", "drain_timeout", drainTimeout)
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		slog.Warn("drain timeout passed, aborting in-flight work")
+		abort()
+		<-drained
+	}
+	slog.Info("shutdown complete")
 }